@@ -1,10 +1,14 @@
 package bootstrap
 
 import (
+	"slices"
+
 	"github.com/spf13/cobra"
 	"go.uber.org/fx"
 
 	"github.com/southernlabs-io/go-fw/cmd"
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/log"
 )
 
 var rootCmd = &cobra.Command{
@@ -15,9 +19,47 @@ var rootCmd = &cobra.Command{
 	It is build with uber-go/fx, gin-gonic/gin and based on dipeshdulal/clean-gin. 
 	`,
 	TraverseChildren: true,
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		if !cmd.Flags().Changed(configFlag) {
+			return nil
+		}
+		files, err := cmd.Flags().GetStringArray(configFlag)
+		if err != nil {
+			return err
+		}
+		config.SetConfigFiles(files...)
+		// The default logger factory was created with the config loaded before the flags were parsed
+		root, err := config.GetRootConfigE()
+		if err != nil {
+			return err
+		}
+		log.SetDefaultLoggerFactory(log.NewLoggerFactory(root))
+		return nil
+	},
+}
+
+const configFlag = "config"
+
+func init() {
+	// The persistent hooks of the sub-commands don't replace the one of the root command, which applies the config flag
+	cobra.EnableTraverseRunHooks = true
+	rootCmd.PersistentFlags().StringArrayP(
+		configFlag,
+		"c",
+		nil,
+		"config file to load instead of config.yaml and its overlays, "+
+			"it can be repeated to merge several files in order. It overrides the "+config.ConfigFileEnvVar+" env var",
+	)
 }
 
+// NewApp creates the root command with the given sub-commands. The app:config and app:config:schema commands, see
+// cmd.ConfigCommand and cmd.ConfigSchemaCommand, are always added for config.Config, unless other ones are given.
 func NewApp(commands ...cmd.Command) *cobra.Command {
+	for _, configCmd := range []cmd.Command{cmd.NewConfigCommand(), cmd.NewConfigSchemaCommand()} {
+		if !slices.ContainsFunc(commands, func(c cmd.Command) bool { return c.Cmd() == configCmd.Cmd() }) {
+			commands = append(commands, configCmd)
+		}
+	}
 	rootCmd.AddCommand(cmd.WrapSubCommands(commands)...)
 	return rootCmd
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// ConfigCommand prints the effective configuration, annotating every value with its source: yaml, dotenv, env, secret
+// or default. Values taken from secrets are redacted.
+type ConfigCommand struct {
+	fxOpts fx.Option
+	load   func(root config.RootConfig, secretsMgr config.SecretsManager) (any, config.Sources, error)
+	format string
+}
+
+// NewConfigCommand creates a ConfigCommand for config.Config.
+func NewConfigCommand(fxOpts ...fx.Option) *ConfigCommand {
+	return NewConfigCommandFor[config.Config](fxOpts...)
+}
+
+// NewConfigCommandFor creates a ConfigCommand for the config type of the app, which usually embeds config.Config.
+//
+// If fxOpts provide a config.SecretsManager, it is used to resolve the secrets, which are redacted anyway. Otherwise, the
+// secrets are not resolved, see config.RedactedSecretsManager.
+func NewConfigCommandFor[T any](fxOpts ...fx.Option) *ConfigCommand {
+	return &ConfigCommand{
+		fxOpts: fx.Options(fxOpts...),
+		load: func(root config.RootConfig, secretsMgr config.SecretsManager) (any, config.Sources, error) {
+			conf := new(T)
+			sources, err := config.LoadConfigWithSourcesE(root, conf, secretsMgr)
+			return conf, sources, err
+		},
+	}
+}
+
+func (c *ConfigCommand) Cmd() string {
+	return "app:config"
+}
+
+func (c *ConfigCommand) Short() string {
+	return "print the effective configuration and the source of each value"
+}
+
+func (c *ConfigCommand) Setup(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&c.format, "output", "o", string(config.OutputFormatYAML), "output format: yaml or json")
+}
+
+func (c *ConfigCommand) GetFXOpts() fx.Option {
+	return c.fxOpts
+}
+
+func (c *ConfigCommand) Run() CommandRunner {
+	return func(dep struct {
+		fx.In
+
+		RootConf   config.RootConfig
+		SecretsMgr config.SecretsManager `optional:"true"`
+		Shutdowner fx.Shutdowner
+	}) error {
+		secretsMgr := dep.SecretsMgr
+		if secretsMgr == nil {
+			secretsMgr = config.RedactedSecretsManager{}
+		}
+		conf, sources, err := c.load(dep.RootConf, secretsMgr)
+		if err != nil {
+			return errors.NewUnknownf("failed to load config, error: %w", err)
+		}
+		err = config.WriteConfig(os.Stdout, conf, sources, config.OutputFormat(c.format))
+		if err != nil {
+			return errors.NewUnknownf("failed to write config, error: %w", err)
+		}
+		return dep.Shutdowner.Shutdown()
+	}
+}
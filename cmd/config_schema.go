@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+)
+
+// ConfigSchemaCommand prints the JSON Schema of the config files, see config.Schema.
+type ConfigSchemaCommand struct {
+	fxOpts fx.Option
+	conf   any
+}
+
+// NewConfigSchemaCommand creates a ConfigSchemaCommand for config.Config.
+func NewConfigSchemaCommand(fxOpts ...fx.Option) *ConfigSchemaCommand {
+	return NewConfigSchemaCommandFor[config.Config](fxOpts...)
+}
+
+// NewConfigSchemaCommandFor creates a ConfigSchemaCommand for the config type of the app, which usually embeds
+// config.Config.
+func NewConfigSchemaCommandFor[T any](fxOpts ...fx.Option) *ConfigSchemaCommand {
+	return &ConfigSchemaCommand{
+		fxOpts: fx.Options(fxOpts...),
+		conf:   new(T),
+	}
+}
+
+func (c *ConfigSchemaCommand) Cmd() string {
+	return "app:config:schema"
+}
+
+func (c *ConfigSchemaCommand) Short() string {
+	return "print the JSON Schema of the config files"
+}
+
+func (c *ConfigSchemaCommand) Setup(_ *cobra.Command) {
+}
+
+func (c *ConfigSchemaCommand) GetFXOpts() fx.Option {
+	return c.fxOpts
+}
+
+func (c *ConfigSchemaCommand) Run() CommandRunner {
+	return func(shutdowner fx.Shutdowner) error {
+		if err := config.WriteSchema(os.Stdout, c.conf); err != nil {
+			return err
+		}
+		return shutdowner.Shutdown()
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/database/migrate"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+const (
+	MigrateActionUp     = "up"
+	MigrateActionDown   = "down"
+	MigrateActionStatus = "status"
+	MigrateActionRedo   = "redo"
+	MigrateActionCreate = "create"
+)
+
+var migrateActions = []string{
+	MigrateActionUp,
+	MigrateActionDown,
+	MigrateActionStatus,
+	MigrateActionRedo,
+	MigrateActionCreate,
+}
+
+/*
+MigrateCommand runs the database migrations supplied with migrate.Provide:
+
+	app:migrate up                applies all the pending migrations
+	app:migrate down              rolls back the last applied migration
+	app:migrate status            prints the status of every migration
+	app:migrate redo              rolls back the last applied migration and applies it again
+	app:migrate create NAME       creates a new SQL migration in the --dir folder, or a Go one with --type go
+
+The create action doesn't connect to the database.
+*/
+type MigrateCommand struct {
+	fxOpts        fx.Option
+	args          []string
+	dir           string
+	migrationType string
+}
+
+// NewMigrateCommand creates a MigrateCommand, the fxOpts must provide the database and the migrations, like:
+//
+//	cmd.NewMigrateCommand(fx.Options(database.Module, migrate.Provide(migrationsFS, "migrations")))
+func NewMigrateCommand(fxOpts fx.Option) *MigrateCommand {
+	return &MigrateCommand{fxOpts: fx.Options(fxOpts, migrate.Module)}
+}
+
+func (c *MigrateCommand) Cmd() string {
+	return "app:migrate"
+}
+
+func (c *MigrateCommand) Short() string {
+	return "run the database migrations: up, down, status, redo or create NAME"
+}
+
+func (c *MigrateCommand) Setup(cmd *cobra.Command) {
+	cmd.Use = c.Cmd() + " up|down|status|redo|create NAME"
+	cmd.ValidArgs = migrateActions
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 || !slices.Contains(migrateActions, args[0]) {
+			return errors.Newf(errors.ErrCodeBadArgument, "an action is required, one of: %v", migrateActions)
+		}
+		if args[0] == MigrateActionCreate {
+			return cobra.ExactArgs(2)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	}
+	// The args are only available to the cobra hooks
+	cmd.PreRun = func(_ *cobra.Command, args []string) {
+		c.args = args
+	}
+	cmd.Flags().StringVar(&c.dir, "dir", "migrations", "folder of the new migration, for create")
+	cmd.Flags().StringVar(
+		&c.migrationType,
+		"type",
+		string(goose.TypeSQL),
+		"type of the new migration: sql or go, for create",
+	)
+}
+
+func (c *MigrateCommand) GetFXOpts() fx.Option {
+	if c.action() == MigrateActionCreate {
+		return fx.Options()
+	}
+	return c.fxOpts
+}
+
+func (c *MigrateCommand) action() string {
+	if len(c.args) == 0 {
+		return ""
+	}
+	return c.args[0]
+}
+
+func (c *MigrateCommand) Run() CommandRunner {
+	if c.action() == MigrateActionCreate {
+		return func(shutdowner fx.Shutdowner) error {
+			if err := c.create(c.args[1]); err != nil {
+				return err
+			}
+			return shutdowner.Shutdown()
+		}
+	}
+	return func(dep struct {
+		fx.In
+
+		Migrator   *migrate.Migrator
+		Shutdowner fx.Shutdowner
+	}) error {
+		ctx := context.Background()
+		var err error
+		switch c.action() {
+		case MigrateActionUp:
+			_, err = dep.Migrator.Up(ctx)
+		case MigrateActionDown:
+			_, err = dep.Migrator.Down(ctx)
+		case MigrateActionRedo:
+			_, err = dep.Migrator.Redo(ctx)
+		case MigrateActionStatus:
+			err = c.printStatus(ctx, dep.Migrator)
+		default:
+			err = errors.Newf(errors.ErrCodeBadArgument, "unknown action: %s", c.action())
+		}
+		if err != nil {
+			return err
+		}
+		return dep.Shutdowner.Shutdown()
+	}
+}
+
+func (c *MigrateCommand) create(name string) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return errors.NewUnknownf("failed to create the migrations dir: %s, error: %w", c.dir, err)
+	}
+	if err := goose.Create(nil, c.dir, name, c.migrationType); err != nil {
+		return errors.NewUnknownf("failed to create migration: %s, error: %w", name, err)
+	}
+	return nil
+}
+
+func (c *MigrateCommand) printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+	for _, status := range statuses {
+		appliedAt := "Pending"
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", appliedAt, status.Source.Path)
+	}
+	return w.Flush()
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-contrib/cors"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"go.uber.org/fx"
 
 	"github.com/southernlabs-io/go-fw/errors"
@@ -20,12 +23,89 @@ type DatabaseConfig struct {
 	Port int
 	User string
 	Pass string
+	// DBName overrides the name of the database, which is built from the app and env names by default.
+	DBName string
+	// ApplicationName is reported to Postgres, like in pg_stat_activity. The app name is used by default.
+	ApplicationName string
+
+	// SSLMode is the libpq sslmode, the pgx default is prefer.
+	SSLMode string `validate:"oneof=disable|allow|prefer|require|verify-ca|verify-full"`
+	// SSLRootCert is the path of the root CA certificates used to verify the server with verify-ca and verify-full.
+	SSLRootCert string
+
+	// MaxOpenConns is the maximum number of open connections, 0 means unlimited.
+	MaxOpenConns int `validate:"min=0"`
+	// MaxIdleConns is the maximum number of idle connections, 0 keeps the database/sql default of 2, and a negative
+	// number disables them.
+	MaxIdleConns int
+	// ConnMaxLifetime is the maximum time a connection is reused, 0 means forever.
+	ConnMaxLifetime time.Duration `validate:"min=0s"`
+	// ConnMaxIdleTime is the maximum time a connection is idle before it is closed, 0 means forever.
+	ConnMaxIdleTime time.Duration `validate:"min=0s"`
+
+	// ConnectTimeout is the timeout to establish a new connection, 0 means no timeout.
+	ConnectTimeout time.Duration `validate:"min=0s"`
+	// StatementTimeout aborts the statements that take longer, 0 means no timeout. It is sent as a startup parameter,
+	// which PgBouncer doesn't support, set it on the role instead.
+	StatementTimeout time.Duration `validate:"min=0s"`
+
+	// Replicas are the read replicas, they use the same settings as the primary. See database.ReadOnly.
+	Replicas []DatabaseReplicaConfig
+	// ReplicaMaxLag is the replication lag after which a replica is removed from rotation, 0 means no limit.
+	ReplicaMaxLag time.Duration `default:"30s" validate:"min=0s"`
+	// ReplicaCheckInterval is how often the replicas are checked, 0 means they are only checked on startup.
+	ReplicaCheckInterval time.Duration `default:"10s" validate:"min=0s"`
+	// ReplicasRequired fails the health check when no replica is healthy. By default, the health check only logs them,
+	// as the reads fall back to the primary.
+	ReplicasRequired bool
+
+	// TxMaxRetries is how many times database.RunInTx retries a transaction that failed with a serialization failure or
+	// a deadlock.
+	TxMaxRetries int `default:"3" validate:"min=0"`
+	// TxRetryBackoff is the delay before the first retry, it doubles on every retry, with jitter.
+	TxRetryBackoff time.Duration `default:"50ms" validate:"min=0s"`
+	// TxRetryMaxBackoff is the maximum delay between retries.
+	TxRetryMaxBackoff time.Duration `default:"1s" validate:"min=0s"`
+}
+
+type DatabaseReplicaConfig struct {
+	Host string
+	// Port is the port of the replica, 0 means the port of the primary.
+	Port int
+}
+
+// Validate requires the host of the replica.
+func (c DatabaseReplicaConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Host, validation.Required),
+		validation.Field(&c.Port, validation.Min(0), validation.Max(65535)),
+	)
+}
+
+// Validate allows an empty config for apps without a database, otherwise the connection settings are required.
+func (c DatabaseConfig) Validate() error {
+	if c.Host == "" && c.Port == 0 && c.User == "" && c.Pass == "" {
+		return nil
+	}
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Host, validation.Required),
+		validation.Field(&c.Port, validation.Min(0), validation.Max(65535)),
+		validation.Field(&c.User, validation.Required),
+	)
 }
 
 type CORS struct {
 	cors.Config
 }
 
+// Validate allows an empty config, which disables CORS, otherwise it must be a valid cors.Config.
+func (c CORS) Validate() error {
+	if reflect.ValueOf(c.Config).IsZero() {
+		return nil
+	}
+	return c.Config.Validate()
+}
+
 func (c CORS) MarshalJSON() ([]byte, error) {
 	// These are all the JSON compatible field of cors.Config@v1.7.2
 	m := map[string]interface{}{
@@ -49,7 +129,7 @@ func (c CORS) MarshalJSON() ([]byte, error) {
 
 type HttpServerConfig struct {
 	BindAddress       string
-	Port              int
+	Port              int `validate:"min=0,max=65535"`
 	ReqLoggerExcludes []string
 	BasePath          string
 	CORS              CORS
@@ -82,15 +162,23 @@ const EnvTypeSandbox EnvType = "sandbox"
 const EnvTypeLocal EnvType = "local"
 const EnvTypeTest EnvType = "test"
 
+// Enum returns the valid env types.
+func (EnvType) Enum() []string {
+	return []string{string(EnvTypeProd), string(EnvTypeSandbox), string(EnvTypeLocal), string(EnvTypeTest)}
+}
+
 type Host string
 
 func (h *Host) MarshalText() ([]byte, error) {
 	return []byte(*h), nil
 }
 
+// HostnamePlaceholder is the Host value replaced by the hostname of the machine, it is the default of EnvConfig.Host.
+const HostnamePlaceholder = "{Hostname}"
+
 func (h *Host) UnmarshalText(text []byte) error {
 	*h = Host(text)
-	if *h == "" {
+	if *h == HostnamePlaceholder {
 		hostname, err := os.Hostname()
 		if err != nil {
 			return errors.NewUnknownf("failed to get hostname: %w", err)
@@ -102,8 +190,8 @@ func (h *Host) UnmarshalText(text []byte) error {
 
 type EnvConfig struct {
 	Name string
-	Type EnvType
-	Host Host
+	Type EnvType `validate:"oneof=prod|sandbox|local|test"`
+	Host Host    `default:"{Hostname}"`
 }
 
 type LogConfigWriter string
@@ -122,14 +210,19 @@ func (w *LogConfigWriter) UnmarshalText(text []byte) error {
 	switch LogConfigWriter(writerStr) {
 	case LogConfigWriterStdout, LogConfigWriterStderr, LogConfigWriterBuffer:
 		*w = LogConfigWriter(writerStr)
-	case "":
-		*w = LogConfigWriterStdout
 	default:
 		return fmt.Errorf("invalid logger writer: %s", writerStr)
 	}
 	return nil
 }
 
+// Enum returns the valid logger writers
+//
+//goland:noinspection GoMixedReceiverTypes
+func (LogConfigWriter) Enum() []string {
+	return []string{string(LogConfigWriterStdout), string(LogConfigWriterStderr), string(LogConfigWriterBuffer)}
+}
+
 // MarshalText returns the string representation of a logger writer
 //
 //goland:noinspection GoMixedReceiverTypes
@@ -173,6 +266,17 @@ func (l *LogLevel) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Enum returns the valid log levels, they are case-insensitive
+//
+//goland:noinspection GoMixedReceiverTypes
+func (LogLevel) Enum() []string {
+	var levels []string
+	for _, level := range []LogLevel{LogLevelTrace, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError} {
+		levels = append(levels, level.String(), strings.ToLower(level.String()))
+	}
+	return levels
+}
+
 // MarshalText returns the string representation of a log level
 //
 //goland:noinspection GoMixedReceiverTypes
@@ -183,17 +287,48 @@ func (l LogLevel) MarshalText() ([]byte, error) {
 type LogConfig struct {
 	Level  LogLevel
 	Levels map[string]LogLevel
-	Writer LogConfigWriter
+	Writer LogConfigWriter `default:"stdout"`
 }
 
 type SecretsConfig struct {
-	PrefixFmt string
-	KeyFmt    string
+	PrefixFmt string `default:"{Name}/{Env.Type}/{Env.Name}/"`
+	KeyFmt    string `default:"{Key}"`
+	// Dir is the directory where the secrets.FileSecretsManager reads the secrets from.
+	Dir string `default:"/run/secrets"`
+	// EnvPrefix is the prefix of the env vars that the secrets.EnvSecretsManager reads the secrets from.
+	EnvPrefix string `default:"SECRET_"`
+	// Vault configures the secrets.VaultSecretsManager.
+	Vault VaultConfig
+	// Cache configures the secrets.CachingSecretsManager.
+	Cache SecretsCacheConfig
+}
+
+// SecretsCacheConfig configures how long the secrets are cached, and how often they are refreshed in the background to
+// detect rotations. A zero RefreshInterval disables the background refresh.
+type SecretsCacheConfig struct {
+	TTL             time.Duration `default:"5m"`
+	RefreshInterval time.Duration `default:"1m"`
+}
+
+// VaultConfig configures the access to a HashiCorp Vault KV v2 secrets engine. The Address and Token default to the
+// VAULT_ADDR and VAULT_TOKEN env vars. If AppRole.RoleID is set, AppRole auth is used instead of the Token.
+type VaultConfig struct {
+	Address   string
+	Namespace string
+	// Mount is the path where the KV v2 secrets engine is mounted.
+	Mount   string `default:"secret"`
+	Token   string
+	AppRole struct {
+		Mount    string `default:"approle"`
+		RoleID   string
+		SecretID string
+	}
+	Timeout time.Duration `default:"10s"`
 }
 
 type SlackConfig struct {
 	Enabled            bool
-	HTTPTimeoutSeconds int
+	HTTPTimeoutSeconds int `validate:"min=0"`
 	WebhookURLs        struct {
 		Info  string
 		Warn  string
@@ -201,12 +336,136 @@ type SlackConfig struct {
 	}
 }
 
+// Validate requires at least one webhook URL when Slack is enabled.
+func (c SlackConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	urls := c.WebhookURLs
+	if urls.Info == "" && urls.Warn == "" && urls.Error == "" {
+		return validation.Errors{
+			"WebhookURLs": validation.NewError("validation_slack_webhook_required", "at least one is required when enabled"),
+		}
+	}
+	return nil
+}
+
+// FlagType is the type of feature flag, see the flags package.
+type FlagType string
+
+const (
+	// FlagTypeBoolean flags are on or off for everyone, with FlagConfig.Enabled.
+	FlagTypeBoolean FlagType = "boolean"
+	// FlagTypePercentage flags are on for the FlagConfig.Percentage of the principals.
+	FlagTypePercentage FlagType = "percentage"
+	// FlagTypeAllowList flags are on for the principals with the IDs in FlagConfig.Principals.
+	FlagTypeAllowList FlagType = "allowList"
+	// FlagTypeVariant flags assign one of the FlagConfig.Variants to every principal.
+	FlagTypeVariant FlagType = "variant"
+)
+
+// Enum returns the valid flag types.
+func (FlagType) Enum() []string {
+	return []string{
+		string(FlagTypeBoolean),
+		string(FlagTypePercentage),
+		string(FlagTypeAllowList),
+		string(FlagTypeVariant),
+	}
+}
+
+// FlagConfig defines a feature flag. An empty Type is a FlagTypeBoolean flag.
+//
+// EnvTypes and Attributes restrict the flag to some env types, and to the requests whose attributes match one of the
+// given values. When they don't match, the flag is off.
+type FlagConfig struct {
+	Type    FlagType
+	Enabled bool
+	// Percentage is the percentage of principals, between 0 and 100, that have the flag on.
+	Percentage float64 `validate:"min=0,max=100"`
+	// Principals are the IDs of the principals that have the flag on.
+	Principals []string
+	// Variants are the weights, in percentage, of every variant. The principals that don't get a variant, when the
+	// weights don't add up to 100, have the flag off.
+	Variants   map[string]float64
+	EnvTypes   []EnvType
+	Attributes map[string][]string
+}
+
+// Validate checks the type and the weights of the variants.
+func (c FlagConfig) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Type, validation.In(
+			FlagTypeBoolean,
+			FlagTypePercentage,
+			FlagTypeAllowList,
+			FlagTypeVariant,
+		)),
+		validation.Field(&c.Variants, validation.By(func(any) error {
+			var total float64
+			for _, weight := range c.Variants {
+				if weight < 0 {
+					return validation.NewError("validation_flag_variant_weight", "weights must not be negative")
+				}
+				total += weight
+			}
+			if total > 100 {
+				return validation.NewError("validation_flag_variant_weight", "weights must add up to 100 or less")
+			}
+			return nil
+		})),
+		validation.Field(&c.Variants, validation.When(c.Type == FlagTypeVariant, validation.Required)),
+	)
+}
+
+type FlagsConfig struct {
+	// Definitions are the feature flags by name.
+	Definitions map[string]FlagConfig
+	// RefreshInterval is how often the flags are loaded from the flags.Store, if there is one.
+	RefreshInterval time.Duration `default:"30s"`
+}
+
+type OutboxConfig struct {
+	// PollInterval is how often the outbox.Relay looks for pending messages while there are none.
+	PollInterval time.Duration `default:"1s" validate:"min=1ms"`
+	// BatchSize is the maximum number of messages published on every poll.
+	BatchSize int `default:"100" validate:"min=1"`
+	// MaxAttempts is how many times a message is published before it is marked as failed, 0 means no limit.
+	MaxAttempts int `default:"10" validate:"min=0"`
+	// RetryBackoff is the delay before the first retry of a message, it doubles on every retry.
+	RetryBackoff time.Duration `default:"1s" validate:"min=0s"`
+	// RetryMaxBackoff is the maximum delay between the retries of a message, 0 means no limit.
+	RetryMaxBackoff time.Duration `default:"5m" validate:"min=0s"`
+	// Retention is how long the delivered messages are kept before they are deleted.
+	Retention time.Duration `default:"24h" validate:"min=0s"`
+	// LockTTL is the TTL of the lock that lets only one instance of the app publish the messages.
+	LockTTL time.Duration `default:"30s" validate:"min=1s"`
+}
+
+type PaginationConfig struct {
+	// CursorKey is the hex encoded key that signs the cursors of the pages, so the clients can't tamper with them.
+	CursorKey string
+	// DefaultSize is the size of the pages when the request doesn't give one.
+	DefaultSize int `default:"20" validate:"min=1"`
+	// MaxSize is the maximum size of the pages that a request can ask for.
+	MaxSize int `default:"100" validate:"min=1"`
+}
+
+type TenancyConfig struct {
+	// Header is the request header with the tenant ID, used when the principal has no tenant, if AllowHeaderTenant.
+	Header string `default:"X-Tenant-ID"`
+	// AllowHeaderTenant trusts the Header when the principal has no tenant, so the client chooses the tenant. Only
+	// enable it when the principals without a tenant, if any, may access every tenant.
+	AllowHeaderTenant bool
+}
+
 type RootConfig struct {
-	Name    string
-	Secrets SecretsConfig
-	Env     EnvConfig
-	Log     LogConfig
-	Datadog DataDogConfig
+	Name       string
+	Secrets    SecretsConfig
+	Env        EnvConfig
+	Log        LogConfig
+	Datadog    DataDogConfig
+	Validation ValidationConfig
 }
 
 type Config struct {
@@ -221,40 +480,116 @@ type Config struct {
 	JWT JWTConfig
 
 	Slack SlackConfig
+
+	Flags FlagsConfig
+
+	Outbox OutboxConfig
+
+	Pagination PaginationConfig
+
+	Tenancy TenancyConfig
 }
 
 func NewConfig(root RootConfig, secretsMgr SecretsManager) Config {
+	conf, err := NewConfigE(root, secretsMgr)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// NewConfigE works like NewConfig, but returns an error instead of panicking, see LoadConfigE.
+func NewConfigE(root RootConfig, secretsMgr SecretsManager) (Config, error) {
 	conf := Config{
 		RootConfig: root,
 	}
-	LoadConfig(root, &conf, secretsMgr)
-	return conf
+	err := LoadConfigE(root, &conf, secretsMgr)
+	return conf, err
 }
 
-func loadRootConfig() RootConfig {
+func loadRootConfig() (RootConfig, error) {
 	var rootConfig RootConfig
-	loadConfig(&rootConfig, nil)
-	return rootConfig
+	_, err := loadConfig(&rootConfig, nil, nil)
+	return rootConfig, err
 }
 
-var loadRootConfigOnce = sync.OnceValue(loadRootConfig)
+var loadRootConfigOnce = sync.OnceValues(loadRootConfig)
 
+// GetRootConfig returns the RootConfig, loading it once. It panics if it fails to load, see GetRootConfigE.
 func GetRootConfig() RootConfig {
+	root, err := GetRootConfigE()
+	if err != nil {
+		panic(err)
+	}
+	return root
+}
+
+// GetRootConfigE works like GetRootConfig, but returns an error instead of panicking.
+func GetRootConfigE() (RootConfig, error) {
 	if testing.Testing() {
 		return loadRootConfig()
 	}
 	return loadRootConfigOnce()
 }
 
+// LoadConfig loads the configuration into dst, resolving the secrets with the secretsMgr, and validates it. It panics
+// with the error of LoadConfigE if it fails.
 func LoadConfig[T any](root RootConfig, dst *T, secretsMgr SecretsManager) {
+	if err := LoadConfigE(root, dst, secretsMgr); err != nil {
+		panic(err)
+	}
+}
+
+/*
+LoadConfigE loads the configuration into dst, resolving the secrets with the secretsMgr, and validates it.
+
+It returns an error with code errors.ErrCodeBadState if the config fails to load, which wraps one LoadError for every
+value that failed, including every secret that failed to load. Values taken from the config files report their file,
+line and column, like:
+
+	{BAD_STATE} failed to load config: *main.Config, 1 errors:
+	  - httpServer.port: /app/config.yaml:4:9: cannot parse 'HttpServer.Port' as int: strconv.ParseInt: parsing "abc": invalid syntax
+
+It returns an error with code errors.ErrCodeValidationFailed listing all the violations if dst is not valid, see
+Validate.
+*/
+func LoadConfigE[T any](root RootConfig, dst *T, secretsMgr SecretsManager) error {
+	return loadAndValidateConfig(root, dst, secretsMgr, nil)
+}
+
+// LoadConfigWithSources works like LoadConfig, and also returns the source of every value of the config.
+func LoadConfigWithSources[T any](root RootConfig, dst *T, secretsMgr SecretsManager) Sources {
+	sources, err := LoadConfigWithSourcesE(root, dst, secretsMgr)
+	if err != nil {
+		panic(err)
+	}
+	return sources
+}
+
+// LoadConfigWithSourcesE works like LoadConfigWithSources, but returns an error instead of panicking, see LoadConfigE.
+func LoadConfigWithSourcesE[T any](root RootConfig, dst *T, secretsMgr SecretsManager) (Sources, error) {
+	sources := Sources{}
+	if err := loadAndValidateConfig(root, dst, secretsMgr, sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+func loadAndValidateConfig[T any](root RootConfig, dst *T, secretsMgr SecretsManager, sources Sources) error {
 	if secretsMgr == nil {
 		secretsMgr = PanicSecretsManager{}
 	}
-	loadConfig(dst, loadSecrets(root, secretsMgr))
+	unknownKeys, err := loadConfig(dst, loadSecrets(root, secretsMgr), sources)
+	if err != nil {
+		return err
+	}
+	violations := checkUnknownKeys(dst, root.Validation, unknownKeys)
+	violations = append(violations, validateValue("", reflect.ValueOf(dst), true)...)
+	return newValidationError(dst, violations)
 }
 
 // Module exports dependency
 var Module = fx.Options(
-	fx.Provide(fx.Annotate(NewConfig, fx.ParamTags("", `optional:"true"`))),
-	fx.Provide(GetRootConfig),
+	fx.Provide(fx.Annotate(NewConfigE, fx.ParamTags("", `optional:"true"`))),
+	fx.Provide(GetRootConfigE),
 )
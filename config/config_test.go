@@ -1,11 +1,22 @@
 package config_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/stretchr/testify/require"
 
 	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -34,3 +45,625 @@ func TestLoadConfig(t *testing.T) {
 	require.True(t, conf.MapConfig["key1"])
 	require.True(t, conf.MapConfig["key2"])
 }
+
+func TestWatcherReload(t *testing.T) {
+	conf := config.NewConfig(config.GetRootConfig(), nil)
+	watcher := config.NewWatcher(conf, nil)
+
+	var oldConf, newConf config.Config
+	calls := 0
+	watcher.Subscribe(func(o, n config.Config) {
+		calls++
+		oldConf, newConf = o, n
+	})
+	watcher.Subscribe(func(_, _ config.Config) {
+		panic("subscriber panics must not affect the others")
+	})
+
+	t.Setenv("LOG_LEVEL", "trace")
+	t.Setenv("HTTPSERVER_PORT", "9090")
+	err := watcher.Reload()
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, conf.Log.Level, oldConf.Log.Level)
+	require.Equal(t, config.LogLevelTrace, newConf.Log.Level)
+	require.Equal(t, 9090, newConf.HttpServer.Port)
+	require.Equal(t, newConf, watcher.Config())
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	filePath := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o600))
+	return filePath
+}
+
+func TestLoadConfigOverlays(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module overlays")
+	writeFile(t, dir, "config.yaml", `
+name: base
+env:
+  type: sandbox
+  name: qa1
+httpServer:
+  port: 8080
+  basePath: /api
+log:
+  levels:
+    gorm: info
+`)
+	writeFile(t, dir, "config.sandbox.yaml", `
+httpserver:
+  port: 8081
+log:
+  levels:
+    redis: warn
+`)
+	writeFile(t, dir, "config.qa1.yaml", `
+HttpServer:
+  Port: 8082
+`)
+	t.Chdir(dir)
+
+	var conf config.Config
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, "base", conf.Name)
+	require.Equal(t, 8082, conf.HttpServer.Port)
+	require.Equal(t, "/api", conf.HttpServer.BasePath)
+	require.Equal(t, config.LogLevelInfo, conf.Log.Levels["gorm"])
+	require.Equal(t, config.LogLevelWarn, conf.Log.Levels["redis"])
+
+	// The env type can be selected with an env var
+	t.Setenv("ENV_TYPE", "prod")
+	writeFile(t, dir, "config.prod.yaml", `
+httpServer:
+  basePath: /prod
+`)
+	conf = config.Config{}
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, config.EnvTypeProd, conf.Env.Type)
+	require.Equal(t, 8082, conf.HttpServer.Port)
+	require.Equal(t, "/prod", conf.HttpServer.BasePath)
+}
+
+func TestLoadConfigExplicitFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := writeFile(t, dir, "first.yaml", `
+name: first
+httpServer:
+  port: 8080
+  basePath: /api
+`)
+	second := writeFile(t, dir, "second.yaml", `
+httpServer:
+  port: 9090
+`)
+	t.Setenv(config.ConfigFileEnvVar, first+", "+second)
+
+	var conf config.Config
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, "first", conf.Name)
+	require.Equal(t, 9090, conf.HttpServer.Port)
+	require.Equal(t, "/api", conf.HttpServer.BasePath)
+	require.Nil(t, conf.Log.Levels)
+}
+
+type validatedConfig struct {
+	config.Config
+
+	Worker struct {
+		Name    string        `validate:"required"`
+		Timeout time.Duration `validate:"min=1s,max=1m"`
+		Mode    string        `validate:"oneof=fast|safe"`
+	}
+	Store storeConfig
+}
+
+type storeConfig struct {
+	URL string
+}
+
+func (c storeConfig) Validate() error {
+	return validation.ValidateStruct(&c, validation.Field(&c.URL, is.URL))
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+env:
+  type: qa
+database:
+  user: postgres
+  port: 70000
+httpServer:
+  port: -1
+slack:
+  enabled: true
+worker:
+  timeout: 2m
+  mode: slow
+store:
+  url: not a url
+`))
+
+	var conf validatedConfig
+	err := catchPanic(func() { config.LoadConfig(config.GetRootConfig(), &conf, nil) })
+	require.Error(t, err)
+	var fwErr *errors.Error
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeValidationFailed, fwErr.Code)
+	for _, path := range []string{
+		"env.type",
+		"database.host",
+		"database.port",
+		"httpServer.port",
+		"slack.webhookURLs",
+		"worker.name",
+		"worker.timeout",
+		"worker.mode",
+		"store.url",
+	} {
+		require.Contains(t, err.Error(), "\n  - "+path+": ")
+	}
+	require.Contains(t, err.Error(), "9 violations")
+
+	require.NoError(t, config.Validate(&config.Config{}))
+}
+
+func TestValidateOneOf(t *testing.T) {
+	type oneOfConfig struct {
+		Port    int  `validate:"oneof=80|443"`
+		Retries *int `validate:"oneof=1|3"`
+		Debug   bool `validate:"oneof=true"`
+	}
+	retries := 2
+	err := config.Validate(oneOfConfig{Port: 8080, Retries: &retries, Debug: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "2 violations")
+	require.Contains(t, err.Error(), "\n  - port: must be a valid value")
+	require.Contains(t, err.Error(), "\n  - retries: must be a valid value")
+	retries = 3
+	require.NoError(t, config.Validate(oneOfConfig{Port: 443, Retries: &retries, Debug: true}))
+	require.NoError(t, config.Validate(oneOfConfig{}))
+
+	// The options that can't be parsed into the type of the field are reported, without panicking
+	err = config.Validate(struct {
+		Mode int `validate:"oneof=fast|safe"`
+	}{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `mode: invalid validate tag: "oneof=fast|safe"`)
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+htpServer:
+  port: 8080
+worker:
+  name: worker
+  timeot: 1s
+`))
+
+	// Unknown keys are only warned by default
+	var conf validatedConfig
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, "worker", conf.Worker.Name)
+
+	t.Setenv("VALIDATION_STRICTKEYS", "true")
+	conf = validatedConfig{}
+	err := catchPanic(func() { config.LoadConfig(config.GetRootConfig(), &conf, nil) })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "2 violations")
+	require.Contains(t, err.Error(), "htpServer: unknown key")
+	require.Contains(t, err.Error(), "worker.timeot: unknown key")
+
+	// Config only reports the keys that can't be of the structs that extend it, like the typos of its sections
+	var baseConf config.Config
+	err = catchPanic(func() { config.LoadConfig(config.GetRootConfig(), &baseConf, nil) })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 violations")
+	require.Contains(t, err.Error(), "htpServer: unknown key")
+}
+
+func catchPanic(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	type Config struct {
+		config.Config
+
+		Worker struct {
+			Name     string          `default:"worker"`
+			Port     int             `default:"8080"`
+			Timeout  time.Duration   `default:"30s"`
+			Hosts    []string        `default:"a.example.com,b.example.com"`
+			LogLevel config.LogLevel `default:"warn"`
+			Enabled  bool            `default:"true"`
+		}
+	}
+
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+worker:
+  port: 9090
+  hosts: [c.example.com]
+`))
+	t.Setenv("WORKER_TIMEOUT", "1m")
+
+	var conf Config
+	conf.Worker.Name = "preset"
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, "preset", conf.Worker.Name)
+	require.Equal(t, 9090, conf.Worker.Port)
+	require.Equal(t, time.Minute, conf.Worker.Timeout)
+	require.Equal(t, []string{"c.example.com"}, conf.Worker.Hosts)
+	require.Equal(t, config.LogLevelWarn, conf.Worker.LogLevel)
+	require.True(t, conf.Worker.Enabled)
+	require.Equal(t, config.LogConfigWriterStdout, conf.Log.Writer)
+	require.Equal(t, "{Key}", conf.Secrets.KeyFmt)
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	require.Equal(t, config.Host(hostname), conf.Env.Host)
+
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "empty.yaml", "name: empty"))
+	conf = Config{}
+	config.LoadConfig(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, "worker", conf.Worker.Name)
+	require.Equal(t, 8080, conf.Worker.Port)
+	require.Equal(t, []string{"a.example.com", "b.example.com"}, conf.Worker.Hosts)
+}
+
+type fakeSecretsManager map[string]string
+
+func (m fakeSecretsManager) GetSecret(_ context.Context, key string) (string, error) {
+	return m[key], nil
+}
+
+func (m fakeSecretsManager) GetSecretVerbatim(_ context.Context, id string) (string, error) {
+	return m[id], nil
+}
+
+type countingSecretsManager struct {
+	fakeSecretsManager
+	calls map[string]int
+}
+
+func (m countingSecretsManager) GetSecret(ctx context.Context, key string) (string, error) {
+	m.calls[key]++
+	return m.fakeSecretsManager.GetSecret(ctx, key)
+}
+
+func (m countingSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	m.calls[id]++
+	return m.fakeSecretsManager.GetSecretVerbatim(ctx, id)
+}
+
+func TestLoadConfigWithSources(t *testing.T) {
+	type Config struct {
+		config.Config
+
+		Worker struct {
+			Timeout time.Duration `default:"30s"`
+		}
+	}
+
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+env:
+  type: local
+httpServer:
+  port: 8080
+  basePath: /api
+database:
+  host: localhost
+  user: postgres
+  pass: <secret:db_pass>
+`))
+	t.Setenv("HTTPSERVER_PORT", "9090")
+
+	var conf Config
+	sources := config.LoadConfigWithSources(
+		config.GetRootConfig(),
+		&conf,
+		fakeSecretsManager{"db_pass": "s3cr3t"},
+	)
+	require.Equal(t, "s3cr3t", conf.Database.Pass)
+	require.Equal(t, config.SourceEnv, sources.Of("httpServer.port"))
+	require.Equal(t, config.SourceYAML, sources.Of("httpServer.basePath"))
+	require.Equal(t, config.SourceSecret, sources.Of("database.pass"))
+	require.Equal(t, config.SourceDefault, sources.Of("worker.timeout"))
+	require.Equal(t, config.Source(""), sources.Of("redis.url"))
+
+	buf := bytes.Buffer{}
+	require.NoError(t, config.WriteConfig(&buf, &conf, sources, config.OutputFormatYAML))
+	out := buf.String()
+	require.Contains(t, out, "  port: 9090 # env\n")
+	require.Contains(t, out, "  basePath: /api # yaml\n")
+	require.Contains(t, out, "  pass: <redacted> # secret\n")
+	require.Contains(t, out, "  timeout: 30s # default\n")
+	require.NotContains(t, out, "s3cr3t")
+
+	buf.Reset()
+	require.NoError(t, config.WriteConfig(&buf, &conf, sources, config.OutputFormatJSON))
+	var jsonOut struct {
+		Config  map[string]any
+		Sources map[string]config.Source
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &jsonOut))
+	require.Equal(t, config.SourceEnv, jsonOut.Sources["httpServer.port"])
+	require.Equal(t, "<redacted>", jsonOut.Config["database"].(map[string]any)["pass"])
+	require.NotContains(t, buf.String(), "s3cr3t")
+
+	// Without a SecretsManager, the secrets are redacted, even the ones with a JSON path
+	t.Setenv("DATABASE_USER", "<secret:db-creds#username>")
+	conf = Config{}
+	sources, err := config.LoadConfigWithSourcesE(config.GetRootConfig(), &conf, config.RedactedSecretsManager{})
+	require.NoError(t, err)
+	require.Equal(t, config.RedactedValue, conf.Database.User)
+	require.Equal(t, config.RedactedValue, conf.Database.Pass)
+	require.Equal(t, config.SourceSecret, sources.Of("database.user"))
+}
+
+func TestLoadConfigJSONSecrets(t *testing.T) {
+	type Config struct {
+		config.Config
+
+		Store struct {
+			Credentials string
+			Region      string
+			Replicas    string
+		}
+	}
+
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+env:
+  type: local
+database:
+  host: localhost
+  user: <secret:db-creds#username>
+  pass: <secret:db-creds#password>
+  port: <secret:db-creds#port>
+store:
+  credentials: <secret>
+  region: <secret#region>
+  replicas: <secret#hosts.1>
+`))
+
+	secretsMgr := countingSecretsManager{
+		fakeSecretsManager: fakeSecretsManager{
+			"db-creds":          `{"username": "admin", "password": "s3cr3t", "port": 5433}`,
+			"Store.Credentials": "plain",
+			"Store.Region":      `{"region": "us-east-1"}`,
+			"Store.Replicas":    `{"hosts": ["a.example.com", "b.example.com"]}`,
+		},
+		calls: map[string]int{},
+	}
+	var conf Config
+	config.LoadConfig(config.GetRootConfig(), &conf, secretsMgr)
+	require.Equal(t, "admin", conf.Database.User)
+	require.Equal(t, "s3cr3t", conf.Database.Pass)
+	require.Equal(t, 5433, conf.Database.Port)
+	require.Equal(t, "plain", conf.Store.Credentials)
+	require.Equal(t, "us-east-1", conf.Store.Region)
+	require.Equal(t, "b.example.com", conf.Store.Replicas)
+	require.Equal(t, 1, secretsMgr.calls["db-creds"])
+
+	t.Setenv("STORE_REGION", "<secret#zone>")
+	err := catchPanic(func() { config.LoadConfig(config.GetRootConfig(), &Config{}, secretsMgr) })
+	require.ErrorContains(t, err, "key not found: zone")
+
+	t.Setenv("STORE_REGION", "<secret#>")
+	err = catchPanic(func() { config.LoadConfig(config.GetRootConfig(), &Config{}, secretsMgr) })
+	require.ErrorContains(t, err, "provide a path or remove '#'")
+
+	// A secret that is not JSON fails to load, with the path of the value
+	t.Setenv("STORE_REGION", "<secret:Store.Credentials#region>")
+	err = config.LoadConfigE(config.GetRootConfig(), &Config{}, secretsMgr)
+	var loadErr *config.LoadError
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, "store.region", loadErr.Path)
+	require.Equal(t, config.SourceSecret, loadErr.Source)
+	require.ErrorContains(t, loadErr, "secret is not valid JSON")
+}
+
+func TestLoadConfigEnvEntries(t *testing.T) {
+	type Config struct {
+		config.Config
+
+		Upstreams []struct {
+			Host string
+			Port int
+		}
+	}
+
+	dir := t.TempDir()
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "config.yaml", `
+log:
+  levels:
+    gorm.io/gorm.DB: info
+httpServer:
+  cors:
+    allowOrigins: [https://a.example.com, https://b.example.com]
+`))
+	t.Setenv("LOG_LEVELS__GORM_IO_GORM_DB", "trace")
+	t.Setenv("LOG_LEVELS__my-app", "error")
+	t.Setenv("HTTPSERVER_CORS_ALLOWORIGINS__1", "https://c.example.com")
+	t.Setenv("HTTPSERVER_CORS_ALLOWORIGINS__2", "https://d.example.com")
+	t.Setenv("UPSTREAMS__0__HOST", "one.example.com")
+	t.Setenv("UPSTREAMS__0__PORT", "8080")
+	t.Setenv("UPSTREAMS__1__HOST", "two.example.com")
+	// Ignored, the items must be added in order
+	t.Setenv("UPSTREAMS__3__HOST", "four.example.com")
+
+	var conf Config
+	sources := config.LoadConfigWithSources(config.GetRootConfig(), &conf, nil)
+	require.Equal(t, map[string]config.LogLevel{
+		"gorm.io/gorm.DB": config.LogLevelTrace,
+		"my-app":          config.LogLevelError,
+	}, conf.Log.Levels)
+	require.Equal(
+		t,
+		[]string{"https://a.example.com", "https://c.example.com", "https://d.example.com"},
+		conf.HttpServer.CORS.AllowOrigins,
+	)
+	require.Len(t, conf.Upstreams, 2)
+	require.Equal(t, "one.example.com", conf.Upstreams[0].Host)
+	require.Equal(t, 8080, conf.Upstreams[0].Port)
+	require.Equal(t, "two.example.com", conf.Upstreams[1].Host)
+	require.Equal(t, config.SourceEnv, sources.Of("log.levels.my-app"))
+	require.Equal(t, config.SourceEnv, sources.Of("httpServer.cors.allowOrigins"))
+}
+
+func TestLoadConfigE(t *testing.T) {
+	dir := t.TempDir()
+	confFile := writeFile(t, dir, "config.yaml", `
+env:
+  type: local
+httpServer:
+  port: 8080
+database:
+  host: localhost
+  user: <secret:db#user>
+  pass: <secret:db_pass>
+  port: <secret:db#port>
+`)
+	t.Setenv(config.ConfigFileEnvVar, confFile)
+
+	root, err := config.GetRootConfigE()
+	require.NoError(t, err)
+	var conf config.Config
+	err = config.LoadConfigE(root, &conf, fakeSecretsManager{"db_pass": "s3cr3t", "db": "{}"})
+	var fwErr *errors.Error
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeBadState, fwErr.Code)
+	require.ErrorContains(t, err, "2 errors")
+	require.ErrorContains(t, err, "could not extract: port from secret: db")
+	require.ErrorContains(t, err, "could not extract: user from secret: db")
+
+	var loadErr *config.LoadError
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, "database.port", loadErr.Path)
+	require.Equal(t, config.SourceSecret, loadErr.Source)
+
+	secretsMgr := fakeSecretsManager{"db_pass": "s3cr3t", "db": `{"user": "admin", "port": "abc"}`}
+	_, err = config.NewConfigE(root, secretsMgr)
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, "database.port", loadErr.Path)
+	require.Equal(t, config.SourceSecret, loadErr.Source)
+	require.ErrorContains(t, err, "cannot parse 'Database.Port' as int")
+
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "port.yaml", `
+env:
+  type: local
+httpServer:
+  port: abc
+`))
+	_, err = config.NewConfigE(root, secretsMgr)
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, "httpServer.port", loadErr.Path)
+	require.Equal(t, config.SourceYAML, loadErr.Source)
+	require.Equal(t, filepath.Join(dir, "port.yaml"), loadErr.File)
+	require.Equal(t, 5, loadErr.Line)
+	require.Equal(t, 9, loadErr.Column)
+	require.ErrorContains(t, err, filepath.Join(dir, "port.yaml")+":5:9: cannot parse 'HttpServer.Port' as int")
+
+	t.Setenv(config.ConfigFileEnvVar, confFile)
+	t.Setenv("HTTPSERVER_PORT", "xyz")
+	_, err = config.NewConfigE(root, fakeSecretsManager{"db_pass": "s3cr3t", "db": `{"user": "admin", "port": 5432}`})
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, config.SourceEnv, loadErr.Source)
+	require.Empty(t, loadErr.File)
+
+	t.Setenv(config.ConfigFileEnvVar, writeFile(t, dir, "invalid.yaml", "env:\n  type: local\n  name: [a\n"))
+	_, err = config.GetRootConfigE()
+	require.ErrorAs(t, err, &loadErr)
+	require.Equal(t, filepath.Join(dir, "invalid.yaml"), loadErr.File)
+	require.Positive(t, loadErr.Line)
+}
+
+func TestSchema(t *testing.T) {
+	type Config struct {
+		config.Config
+
+		Worker struct {
+			Timeout time.Duration `default:"30s"`
+			Hosts   []string      `default:"a.example.com,b.example.com"`
+			Retries int           `default:"3" validate:"min=1,max=10"`
+		}
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, config.WriteSchema(&buf, &Config{}))
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &schema))
+	require.Equal(t, config.SchemaVersion, schema["$schema"])
+	require.Equal(t, false, schema["additionalProperties"])
+
+	// Every reference must point to a schema
+	var checkRefs func(node any)
+	checkRefs = func(node any) {
+		switch v := node.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				var target any = schema
+				for _, segment := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+					if items, isArray := target.([]any); isArray {
+						idx, err := strconv.Atoi(segment)
+						require.NoError(t, err, ref)
+						target = items[idx]
+						continue
+					}
+					target = target.(map[string]any)[segment]
+				}
+				require.NotNil(t, target, ref)
+			}
+			for _, child := range v {
+				checkRefs(child)
+			}
+		case []any:
+			for _, child := range v {
+				checkRefs(child)
+			}
+		}
+	}
+	checkRefs(schema)
+
+	property := func(path ...string) map[string]any {
+		node := schema
+		for _, key := range path {
+			node = node["properties"].(map[string]any)[key].(map[string]any)
+		}
+		return node
+	}
+	valueOf := func(node map[string]any) map[string]any {
+		anyOf := node["anyOf"].([]any)
+		require.Equal(t, "#/$defs/secretRef", anyOf[1].(map[string]any)["$ref"])
+		return anyOf[0].(map[string]any)
+	}
+
+	require.Contains(t, property("httpServer", "cors"), "properties")
+	require.Contains(t, property("httpServer", "cors")["properties"], "allowOrigins")
+	require.Equal(
+		t,
+		map[string]any{"$ref": "#/properties/httpServer"},
+		schema["patternProperties"].(map[string]any)["^[hH][tT][tT][pP][sS][eE][rR][vV][eE][rR]$"],
+	)
+	require.Equal(t, []any{"prod", "sandbox", "local", "test"}, valueOf(property("env", "type"))["enum"])
+	require.Contains(t, valueOf(property("log", "level"))["enum"], "INFO")
+	require.Equal(t, []any{"stdout", "stderr", "buffer"}, valueOf(property("log", "writer"))["enum"])
+	require.Equal(t, "stdout", property("log", "writer")["default"])
+	require.Equal(t, "integer", valueOf(property("httpServer", "port"))["type"])
+	require.Equal(t, float64(65535), valueOf(property("httpServer", "port"))["maximum"])
+	require.Equal(t, "30s", property("worker", "timeout")["default"])
+	require.Equal(t, []any{"a.example.com", "b.example.com"}, property("worker", "hosts")["default"])
+	require.Equal(t, float64(3), property("worker", "retries")["default"])
+	require.Equal(t, float64(1), valueOf(property("worker", "retries"))["minimum"])
+}
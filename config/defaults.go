@@ -0,0 +1,101 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DefaultTagName is the struct tag used to declare the default value of a config field. The value is decoded like any
+// value in the config files, so it supports every type that the config supports, for example:
+//
+//	type MyConfig struct {
+//		Port     int           `default:"8080"`
+//		Timeout  time.Duration `default:"30s"`
+//		Hosts    []string      `default:"a.example.com,b.example.com"`
+//		LogLevel LogLevel      `default:"info"`
+//	}
+//
+// The default is only used if the key is not in the config files and the field was not already set in the struct
+// passed to LoadConfig. Env vars and secrets are applied on top of the defaults.
+const DefaultTagName = "default"
+
+// applyDefaults adds the default values declared with DefaultTagName to the confMap, for the keys that are missing.
+// The conf value is used to skip the fields that are already set, it must be a struct or a pointer to one.
+func applyDefaults(confMap map[string]any, conf reflect.Value) {
+	for conf.Kind() == reflect.Pointer {
+		if conf.IsNil() {
+			conf = reflect.New(conf.Type().Elem())
+		}
+		conf = conf.Elem()
+	}
+	if conf.Kind() != reflect.Struct {
+		return
+	}
+
+	t := conf.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := conf.Field(i)
+		// Embedded structs are squashed, so their fields are at the same level
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			applyDefaults(confMap, fieldValue)
+			continue
+		}
+
+		key := field.Name
+		if mapKey, found := findKeyFold(confMap, key); found {
+			key = mapKey
+		}
+		val, present := confMap[key]
+
+		if defaultVal, ok := field.Tag.Lookup(DefaultTagName); ok {
+			if (!present || val == nil) && fieldValue.IsZero() {
+				confMap[key] = defaultVal
+			}
+			continue
+		}
+
+		if field.Type.Kind() != reflect.Struct || !hasDefaults(field.Type) {
+			continue
+		}
+		if !present || val == nil {
+			subMap := make(map[string]any)
+			applyDefaults(subMap, fieldValue)
+			if len(subMap) > 0 {
+				confMap[key] = subMap
+			}
+		} else if subMap, ok := val.(map[string]any); ok {
+			applyDefaults(subMap, fieldValue)
+		}
+	}
+}
+
+// hasDefaults returns true if the struct type, or any of its nested structs, declares a default value.
+func hasDefaults(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup(DefaultTagName); ok {
+			return true
+		}
+		if field.Type.Kind() == reflect.Struct && hasDefaults(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// findKeyFold returns the key in m that matches the given key case-insensitively, like mapstructure does.
+func findKeyFold(m map[string]any, key string) (string, bool) {
+	if _, present := m[key]; present {
+		return key, true
+	}
+	for mKey := range m {
+		if strings.EqualFold(mKey, key) {
+			return mKey, true
+		}
+	}
+	return "", false
+}
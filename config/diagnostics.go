@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// LoadError is the failure to load one value of the config. The errors returned by LoadConfigE wrap one LoadError for
+// every value that failed, they can be extracted with errors.As.
+type LoadError struct {
+	// Path is the YAML path of the value, like: httpServer.port. It is empty if the failure is not related to a value.
+	Path string
+	// Source is where the value was taken from, if known.
+	Source Source
+	// File, Line and Column are the position of the value in the config file it was taken from, if known.
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	buf := strings.Builder{}
+	if e.Path != "" {
+		buf.WriteString(e.Path)
+		buf.WriteString(": ")
+	}
+	switch {
+	case e.File != "" && e.Column > 0:
+		buf.WriteString(fmt.Sprintf("%s:%d:%d: ", e.File, e.Line, e.Column))
+	case e.File != "" && e.Line > 0:
+		buf.WriteString(fmt.Sprintf("%s:%d: ", e.File, e.Line))
+	case e.File != "":
+		buf.WriteString(e.File)
+		buf.WriteString(": ")
+	case e.Source != "":
+		buf.WriteString(fmt.Sprintf("(%s) ", e.Source))
+	}
+	buf.WriteString(e.Err.Error())
+	return buf.String()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// newLoadError returns an error with code errors.ErrCodeBadState wrapping all the loadErrs, or nil if there are none.
+func newLoadError(conf any, loadErrs []*LoadError) error {
+	if len(loadErrs) == 0 {
+		return nil
+	}
+	format := "failed to load config: %T, %d errors:" + strings.Repeat("\n  - %w", len(loadErrs))
+	args := []any{conf, len(loadErrs)}
+	for _, loadErr := range loadErrs {
+		args = append(args, loadErr)
+	}
+	return errors.Newf(errors.ErrCodeBadState, format, args...)
+}
+
+// filePosition is the position of a value in a config file.
+type filePosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// yamlPositions returns the position of every value of the files, by its lowercase path. Items of lists are indexed
+// like: hosts[0]. The values of later files replace the ones of earlier files, like when they are merged.
+func yamlPositions(files []configFile) map[string]filePosition {
+	positions := make(map[string]filePosition)
+	var walk func(file, path string, node *yaml.Node)
+	walk = func(file, path string, node *yaml.Node) {
+		if path != "" {
+			positions[path] = filePosition{file: file, line: node.Line, column: node.Column}
+		}
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(file, path, child)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(file, joinPath(path, strings.ToLower(node.Content[i].Value)), node.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(file, fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+		}
+	}
+	for _, file := range files {
+		var root yaml.Node
+		// Invalid files fail to be merged, their positions are not needed
+		if err := yaml.Unmarshal(file.content, &root); err == nil {
+			walk(file.path, "", &root)
+		}
+	}
+	return positions
+}
+
+var yamlLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// newYAMLLoadError converts an error unmarshalling a config file to a LoadError, with the line taken from the message.
+func newYAMLLoadError(file string, err error) *LoadError {
+	loadErr := &LoadError{Source: SourceYAML, File: file, Err: err}
+	if match := yamlLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+		loadErr.Line, _ = strconv.Atoi(match[1])
+	}
+	return loadErr
+}
+
+var decodeErrNameRegexp = regexp.MustCompile(`'([^']+)'`)
+
+// newDecodeLoadErrors converts the error decoding the config map to one LoadError per failing value, with the position
+// of the value in the config files if it was taken from them.
+func newDecodeLoadErrors(files []configFile, sources Sources, decodeErr error) []*LoadError {
+	decodeErrs := []error{decodeErr}
+	var msErr *mapstructure.Error
+	if errors.As(decodeErr, &msErr) {
+		decodeErrs = msErr.WrappedErrors()
+	}
+
+	positions := yamlPositions(files)
+	loadErrs := make([]*LoadError, 0, len(decodeErrs))
+	for _, err := range decodeErrs {
+		loadErr := &LoadError{Err: err}
+		loadErrs = append(loadErrs, loadErr)
+		// mapstructure quotes the name of the field, like: 'HttpServer.Port'
+		match := decodeErrNameRegexp.FindStringSubmatch(err.Error())
+		if match == nil {
+			continue
+		}
+		loadErr.Path = yamlPath(match[1])
+		lowerPath := strings.ToLower(loadErr.Path)
+		loadErr.Source = sourceOfPath(sources, lowerPath)
+		if loadErr.Source != SourceYAML {
+			continue
+		}
+		if position, found := positions[lowerPath]; found {
+			loadErr.File, loadErr.Line, loadErr.Column = position.file, position.line, position.column
+		}
+	}
+	return loadErrs
+}
+
+// sourceOfPath returns the source of the value at path, or the one of its closest parent, which is the case of the items
+// of lists.
+func sourceOfPath(sources Sources, path string) Source {
+	for path != "" {
+		if source := sources.Of(path); source != "" {
+			return source
+		}
+		if idx := strings.LastIndexAny(path, ".["); idx != -1 {
+			path = path[:idx]
+		} else {
+			path = ""
+		}
+	}
+	return ""
+}
+
+// yamlPath converts a path with field names, like HttpServer.CORS.AllowOrigins[0], to a YAML path, like
+// httpServer.cors.allowOrigins[0].
+func yamlPath(fieldPath string) string {
+	segments := strings.Split(fieldPath, ".")
+	for i, segment := range segments {
+		segments[i] = yamlKey(segment)
+	}
+	return strings.Join(segments, ".")
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+// ConfigFileEnvVar is the env var used to provide an explicit comma separated list of config files.
+const ConfigFileEnvVar = "CONFIG_FILE"
+
+// explicitConfigFiles are the config files set with SetConfigFiles.
+var explicitConfigFiles []string
+
+// SetConfigFiles sets an explicit list of config files that replaces the default chain of config files. The files are
+// deep merged in the given order, later files override earlier ones. It takes precedence over the CONFIG_FILE env var.
+// The --config/-c flag of the bootstrap app calls it.
+//
+// It must be called before the configuration is used, as it resets any configuration already loaded.
+func SetConfigFiles(files ...string) {
+	explicitConfigFiles = files
+	loadConfigFiles = sync.OnceValues(readConfigFiles)
+	loadRootConfigOnce = sync.OnceValues(loadRootConfig)
+}
+
+// configFile is a config file found in the filesystem and its content.
+type configFile struct {
+	path    string
+	content []byte
+}
+
+// getExplicitConfigFiles returns the explicitly set config files in this order of precedence: SetConfigFiles, like the
+// --config/-c flag does, CONFIG_FILE env var. It returns nil if none were set.
+func getExplicitConfigFiles() []string {
+	if len(explicitConfigFiles) > 0 {
+		return explicitConfigFiles
+	}
+	if envVal := os.Getenv(ConfigFileEnvVar); envVal != "" {
+		var files []string
+		for _, file := range strings.Split(envVal, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	return nil
+}
+
+// resolveConfigFiles returns the chain of config files to load, in the order they must be merged.
+//
+// If an explicit list of files was set, see getExplicitConfigFiles, it is returned as is. Otherwise, the chain is:
+//
+//  1. config.yaml, found with findConfigFile.
+//  2. config.<env.type>.yaml, in the same folder of config.yaml, if it exists.
+//  3. config.<env.name>.yaml, in the same folder of config.yaml, if it exists.
+//
+// The env.type and env.name values are taken from the ENV_TYPE and ENV_NAME env vars, or from the previous files.
+func resolveConfigFiles() ([]configFile, error) {
+	if explicitFiles := getExplicitConfigFiles(); len(explicitFiles) > 0 {
+		files := make([]configFile, 0, len(explicitFiles))
+		for _, explicitFile := range explicitFiles {
+			filePath, err := absFile(explicitFile)
+			if err != nil {
+				return nil, err
+			}
+			file, err := readConfigFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		return files, nil
+	}
+
+	basePath, err := findConfigFile("config.yaml")
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to find config.yaml, error: %w", err)
+	}
+	baseFile, err := readConfigFile(basePath)
+	if err != nil {
+		return nil, err
+	}
+	files := []configFile{baseFile}
+
+	for _, envKey := range []string{"type", "name"} {
+		confMap, err := mergeConfigFiles(files)
+		if err != nil {
+			return nil, err
+		}
+		envVal := envValue(confMap, envKey)
+		if envVal == "" {
+			continue
+		}
+		overlayPath := filepath.Join(filepath.Dir(basePath), fmt.Sprintf("config.%s.yaml", envVal))
+		if err = statFile(overlayPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		// Skip it if it was already added, it happens when env.type and env.name have the same value
+		if overlayPath == files[len(files)-1].path {
+			continue
+		}
+		overlayFile, err := readConfigFile(overlayPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, overlayFile)
+	}
+	return files, nil
+}
+
+// envValue returns the value of env.<key> from the env vars, or from the confMap if it is not set as an env var.
+func envValue(confMap map[string]any, key string) string {
+	for _, envPair := range os.Environ() {
+		envKey, val, found := strings.Cut(envPair, "=")
+		if found && strings.EqualFold(envKey, "env_"+key) {
+			return val
+		}
+	}
+	envMap, ok := lookupFold(confMap, "env").(map[string]any)
+	if !ok {
+		return ""
+	}
+	if val, ok := lookupFold(envMap, key).(string); ok {
+		return val
+	}
+	return ""
+}
+
+func readConfigFile(filePath string) (configFile, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return configFile{}, errors.NewUnknownf("failed to read config file: %s, error: %w", filePath, err)
+	}
+	return configFile{path: filePath, content: content}, nil
+}
+
+// readConfigFiles resolves and reads the chain of config files. It is not cached, use loadConfigFiles instead.
+func readConfigFiles() ([]configFile, error) {
+	files, err := resolveConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		println("Loading config file: ", file.path)
+	}
+	return files, nil
+}
+
+var loadConfigFiles = sync.OnceValues(readConfigFiles)
+
+// getConfigFiles returns the cached chain of config files, except in tests, where they are always read again.
+func getConfigFiles() ([]configFile, error) {
+	if testing.Testing() {
+		return readConfigFiles()
+	}
+	return loadConfigFiles()
+}
+
+// mergeConfigFiles unmarshals the files and deep merges them in order into a new map.
+func mergeConfigFiles(files []configFile) (map[string]any, error) {
+	confMap := make(map[string]any)
+	for _, file := range files {
+		fileMap := make(map[string]any)
+		err := yaml.Unmarshal(file.content, &fileMap)
+		if err != nil {
+			return nil, newYAMLLoadError(file.path, err)
+		}
+		deepMerge(confMap, fileMap)
+	}
+	return confMap, nil
+}
+
+// deepMerge merges src into dst. Maps are merged recursively, any other value in src replaces the one in dst.
+// Keys are matched case-insensitively, like mapstructure does, keeping the key name of dst.
+func deepMerge(dst, src map[string]any) {
+	for srcKey, srcVal := range src {
+		dstKey := srcKey
+		if key, found := findKeyFold(dst, srcKey); found {
+			dstKey = key
+		}
+		srcMap, srcIsMap := srcVal.(map[string]any)
+		dstMap, dstIsMap := dst[dstKey].(map[string]any)
+		if srcIsMap && dstIsMap {
+			deepMerge(dstMap, srcMap)
+		} else {
+			dst[dstKey] = srcVal
+		}
+	}
+}
+
+// lookupFold returns the value of the key in m, matching it case-insensitively.
+func lookupFold(m map[string]any, key string) any {
+	if mKey, found := findKeyFold(m, key); found {
+		return m[mKey]
+	}
+	return nil
+}
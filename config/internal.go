@@ -7,12 +7,15 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode"
 
 	"github.com/joho/godotenv"
 	"github.com/mitchellh/mapstructure"
-	"gopkg.in/yaml.v3"
 
 	"github.com/southernlabs-io/go-fw/errors"
 	"github.com/southernlabs-io/go-fw/sync"
@@ -111,50 +114,121 @@ func recursiveFileFinder(fileName string, prefix string) (string, error) {
 	return filePath, nil
 }
 
-var loadDotEnv = sync.OnceFunc(func() {
-	dotEnvPath, err := findConfigFile(".env")
+// dotEnvKeys tracks the env vars that were set from the .env file. They are the only ones that can be updated when the
+// file is reloaded, real env vars always take precedence.
+var dotEnvKeys = map[string]bool{}
+var dotEnvMu sync.Mutex
+
+// applyDotEnv sets the env vars found in the .env file at dotEnvPath. Env vars that were already set, and were not set
+// by a previous call, are not overridden. Keys set by a previous call that are no longer present in the file are unset.
+func applyDotEnv(dotEnvPath string) error {
+	envMap, err := godotenv.Read(dotEnvPath)
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			panic(errors.NewUnknownf("failed to find dot env file, error: %w", err))
+		return err
+	}
+
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+	for key, val := range envMap {
+		if _, present := os.LookupEnv(key); present && !dotEnvKeys[key] {
+			continue
 		}
-	} else {
-		println("Loading dot env file: ", dotEnvPath)
-		err = godotenv.Load(dotEnvPath)
-		if err != nil {
-			panic(errors.NewUnknownf("failed to load dot env file: %s, error: %w", dotEnvPath, err))
+		if err = os.Setenv(key, val); err != nil {
+			return err
 		}
+		dotEnvKeys[key] = true
 	}
-})
+	for key := range dotEnvKeys {
+		if _, present := envMap[key]; !present {
+			if err = os.Unsetenv(key); err != nil {
+				return err
+			}
+			delete(dotEnvKeys, key)
+		}
+	}
+	return nil
+}
 
-var loadConfigYaml = sync.OnceValue(func() []byte {
-	yamlConfPath, err := findConfigFile("config.yaml")
-	if err != nil {
-		panic(errors.NewUnknownf("failed to read config.yaml, error: %w", err))
+// getDotEnvLowerKeys returns the lowercase keys of the env vars that were set from the .env file.
+func getDotEnvLowerKeys() map[string]bool {
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+	lowerKeys := make(map[string]bool, len(dotEnvKeys))
+	for key := range dotEnvKeys {
+		lowerKeys[strings.ToLower(key)] = true
 	}
+	return lowerKeys
+}
 
-	println("Loading config file: ", yamlConfPath)
-	yamlBytes, err := os.ReadFile(yamlConfPath)
+var loadDotEnv = sync.OnceValue(func() error {
+	dotEnvPath, err := findConfigFile(".env")
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return errors.NewUnknownf("failed to find dot env file, error: %w", err)
+		}
+		return nil
+	}
+	println("Loading dot env file: ", dotEnvPath)
+	err = applyDotEnv(dotEnvPath)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to read config.yaml, error: %w", err))
+		return errors.NewUnknownf("failed to load dot env file: %s, error: %w", dotEnvPath, err)
 	}
-	return yamlBytes
+	return nil
 })
 
-// FIXME: document the process of loading the config
-func loadConfig[T any](conf *T, preprocess func(confMap map[string]any)) {
-	loadDotEnv()
-	yamlBytes := loadConfigYaml()
+// loadConfig loads the .env file, once, and the config files into conf, see decodeConfig.
+func loadConfig[T any](
+	conf *T,
+	preprocess func(confMap map[string]any) []*LoadError,
+	sources Sources,
+) (unknownKeys []string, err error) {
+	if err = loadDotEnv(); err != nil {
+		return nil, err
+	}
+	files, err := getConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(files, conf, preprocess, sources)
+}
 
+// decodeConfig decodes the merged files into conf, binding env vars and calling preprocess before the final decoding.
+// It returns the keys in the files that didn't match any field. If sources is not nil, it is filled with the source of
+// every value.
+//
+// The errors are reported with newLoadError, listing every value that failed with its position in the config files.
+func decodeConfig[T any](
+	files []configFile,
+	conf *T,
+	preprocess func(confMap map[string]any) []*LoadError,
+	sources Sources,
+) (unknownKeys []string, err error) {
 	// Unmarshal to the config struct
 	// We use yaml -> map -> struct, because mapstructure will compare key names using strings.SameFold, which is case insensitive.
-	confMap := make(map[string]any)
-	err := yaml.Unmarshal(yamlBytes, &confMap)
+	confMap, err := mergeConfigFiles(files)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to unmarshal config to map, error: %w", err))
+		var loadErr *LoadError
+		if errors.As(err, &loadErr) {
+			return nil, newLoadError(conf, []*LoadError{loadErr})
+		}
+		return nil, err
 	}
+	// The sources are always tracked, because they are needed to report the errors
+	if sources == nil {
+		sources = Sources{}
+	}
+	sources.setAll(confMap, SourceYAML)
+	withDefaults := deepCopyMap(confMap)
+	applyDefaults(withDefaults, reflect.ValueOf(conf))
+	sources.setMissing(withDefaults, SourceDefault)
+	confMap = withDefaults
+	// Secret references can't be decoded to non string fields, so they are restored after the first decoding
+	secretRefs := extractSecretRefs(nil, confMap)
+	var metadata mapstructure.Metadata
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		WeaklyTypedInput: true,
 		Squash:           true,
+		Metadata:         &metadata,
 		Result:           conf,
 		DecodeHook: mapstructure.ComposeDecodeHookFunc(
 			mapstructure.StringToTimeDurationHookFunc(),
@@ -163,11 +237,11 @@ func loadConfig[T any](conf *T, preprocess func(confMap map[string]any)) {
 		),
 	})
 	if err != nil {
-		panic(errors.NewUnknownf("failed to create decoder: %w", err))
+		return nil, errors.NewUnknownf("failed to create decoder: %w", err)
 	}
 	err = decoder.Decode(confMap)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to decode config map to struct: %T, error: %w", conf, err))
+		return nil, newLoadError(conf, newDecodeLoadErrors(files, sources, err))
 	}
 
 	// Convert the config to a map. This time it will have all the keys, including those that where not specified in the config.yaml
@@ -175,11 +249,15 @@ func loadConfig[T any](conf *T, preprocess func(confMap map[string]any)) {
 	confMap = make(map[string]any)
 	jsonBytes, err := json.Marshal(conf)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to marshal struct to yaml, error: %w", err))
+		return nil, errors.NewUnknownf("failed to marshal struct to yaml, error: %w", err)
 	}
 	err = json.Unmarshal(jsonBytes, &confMap)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to unmarshal struct to map, error: %w", err))
+		return nil, errors.NewUnknownf("failed to unmarshal struct to map, error: %w", err)
+	}
+
+	for _, secretRef := range secretRefs {
+		setPathFold(confMap, secretRef.keys, secretRef.ref)
 	}
 
 	// We use slog because config can't depend on log
@@ -195,27 +273,39 @@ func loadConfig[T any](conf *T, preprocess func(confMap map[string]any)) {
 		}
 		envMap[strings.ToLower(key)] = val
 	}
+	dotEnvLowerKeys := getDotEnvLowerKeys()
 
 	// Bind environment variables to the config map
-	var bindEnvVars func(acc string, m map[string]any)
-	bindEnvVars = func(acc string, m map[string]any) {
+	envTargets := make(map[string]envTarget)
+	var bindEnvVars func(acc, path string, m map[string]any)
+	bindEnvVars = func(acc, path string, m map[string]any) {
 		for key, val := range m {
+			envTargets[acc+strings.ToLower(key)] = envTarget{parent: m, key: key, path: joinPath(path, key)}
 			switch v := val.(type) {
 			case map[string]any:
-				bindEnvVars(acc+strings.ToLower(key)+"_", v)
+				bindEnvVars(acc+strings.ToLower(key)+"_", joinPath(path, key), v)
 			default:
 				envKey := acc + strings.ToLower(key)
 				if envVal, ok := envMap[envKey]; ok {
 					logger.Info(fmt.Sprintf("[%T] Using env key: %s", *conf, envKey))
 					m[key] = envVal
+					if dotEnvLowerKeys[envKey] {
+						sources.Set(joinPath(path, key), SourceDotEnv)
+					} else {
+						sources.Set(joinPath(path, key), SourceEnv)
+					}
 				}
 			}
 		}
 	}
-	bindEnvVars("", confMap)
+	bindEnvVars("", "", confMap)
+	bindEnvEntries(reflect.TypeOf(conf).Elem(), envTargets, dotEnvLowerKeys, sources)
 
 	if preprocess != nil {
-		preprocess(confMap)
+		sources.setSecrets(confMap)
+		if loadErrs := preprocess(confMap); len(loadErrs) > 0 {
+			return nil, newLoadError(conf, loadErrs)
+		}
 	}
 
 	// Create a decoder with all the necessary hooks and decode the map to the conf struct
@@ -230,59 +320,334 @@ func loadConfig[T any](conf *T, preprocess func(confMap map[string]any)) {
 		),
 	})
 	if err != nil {
-		panic(errors.NewUnknownf("failed to create decoder: %w", err))
+		return nil, errors.NewUnknownf("failed to create decoder: %w", err)
 	}
 	err = decoder.Decode(confMap)
 	if err != nil {
-		panic(errors.NewUnknownf("failed to decode config map to struct: %T, error: %w", conf, err))
+		return nil, newLoadError(conf, newDecodeLoadErrors(files, sources, err))
 	}
+	return metadata.Unused, nil
 }
 
-func loadSecrets(conf RootConfig, secretsMgr SecretsManager) func(map[string]any) {
-	return func(confMap map[string]any) {
-		if conf.Env.Type == EnvTypeTest {
+// EnvEntrySeparator separates the map keys and slice indexes in the name of an env var, from the path of the map or
+// slice, like: LOG_LEVELS__GORM_DB or HTTPSERVER_CORS_ALLOWORIGINS__0.
+const EnvEntrySeparator = "__"
+
+// envTarget is a value of the config map that can be set with an env var.
+type envTarget struct {
+	parent map[string]any
+	key    string
+	path   string
+}
+
+// bindEnvEntries sets the map entries and slice items from the env vars that contain EnvEntrySeparator. The first part
+// of the name is the path of the map or slice, found in envTargets, and every following part is a map key, a slice
+// index or a field of a struct item, see setEnvEntry.
+func bindEnvEntries(confType reflect.Type, envTargets map[string]envTarget, dotEnvLowerKeys map[string]bool, sources Sources) {
+	// We use slog because config can't depend on log
+	logger := slog.Default()
+
+	type envEntry struct {
+		key      string
+		val      string
+		segments []string
+	}
+	var envEntries []envEntry
+	for _, envPair := range os.Environ() {
+		envKey, envVal, _ := strings.Cut(envPair, "=")
+		segments := strings.Split(envKey, EnvEntrySeparator)
+		if len(segments) < 2 || slices.Contains(segments, "") {
+			continue
+		}
+		envEntries = append(envEntries, envEntry{key: envKey, val: envVal, segments: segments})
+	}
+	// Sorted with the indexes compared as numbers, so the items of a slice are appended in order
+	slices.SortFunc(envEntries, func(a, b envEntry) int {
+		return slices.CompareFunc(a.segments, b.segments, func(aSeg, bSeg string) int {
+			aIdx, aErr := strconv.Atoi(aSeg)
+			bIdx, bErr := strconv.Atoi(bSeg)
+			if aErr == nil && bErr == nil {
+				return aIdx - bIdx
+			}
+			return strings.Compare(aSeg, bSeg)
+		})
+	})
+
+	for _, entry := range envEntries {
+		envKey, envVal, segments := entry.key, entry.val, entry.segments
+		target, found := envTargets[strings.ToLower(segments[0])]
+		if !found {
+			continue
+		}
+
+		targetType := typeAtPath(confType, strings.Split(target.path, "."))
+		val, err := setEnvEntry(target.parent[target.key], targetType, segments[1:], envVal)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[%s] Failed to use env key: %s, skipping it, error: %s", confType, envKey, err))
+			continue
+		}
+		logger.Info(fmt.Sprintf("[%s] Using env key: %s", confType, envKey))
+		target.parent[target.key] = val
+
+		// The source of a slice is tracked for the whole slice
+		sourcePath := target.path
+		if kind := derefType(targetType).Kind(); kind != reflect.Slice && kind != reflect.Array {
+			sourcePath = joinPath(sourcePath, segments[1])
+		}
+		if dotEnvLowerKeys[strings.ToLower(envKey)] {
+			sources.Set(sourcePath, SourceDotEnv)
+		} else {
+			sources.Set(sourcePath, SourceEnv)
+		}
+	}
+}
+
+// setEnvEntry sets val at the path of the segments inside container, and returns the updated container. The type t of
+// the container decides how every segment is used:
+//   - slices: the segment is the index of an existing item, or the length of the slice to append a new one.
+//   - structs: the segment is the name of the field, matched case-insensitively.
+//   - maps, or unknown types: the segment is the key. Existing keys are matched case-insensitively, with any character
+//     other than letters and digits written as _, otherwise the segment is used as is.
+func setEnvEntry(container any, t reflect.Type, segments []string, val string) (any, error) {
+	if len(segments) == 0 {
+		return val, nil
+	}
+	t = derefType(t)
+	segment := segments[0]
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		idx, err := strconv.Atoi(segment)
+		if err != nil || idx < 0 {
+			return nil, fmt.Errorf("invalid slice index: %s", segment)
+		}
+		items, _ := container.([]any)
+		if idx > len(items) {
+			return nil, fmt.Errorf("slice index: %d, is out of range, the next one is: %d", idx, len(items))
+		}
+		if idx == len(items) {
+			items = append(items, nil)
+		}
+		items[idx], err = setEnvEntry(items[idx], t.Elem(), segments[1:], val)
+		return items, err
+	case reflect.Struct:
+		field, found := t.FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, segment)
+		})
+		if !found {
+			return nil, fmt.Errorf("unknown field: %s, in: %s", segment, t)
+		}
+		m, _ := container.(map[string]any)
+		if m == nil {
+			m = make(map[string]any)
+		}
+		key := field.Name
+		if mKey, present := findKeyFold(m, key); present {
+			key = mKey
+		}
+		var err error
+		m[key], err = setEnvEntry(m[key], field.Type, segments[1:], val)
+		return m, err
+	case reflect.Map, reflect.Interface:
+		m, _ := container.(map[string]any)
+		if m == nil {
+			m = make(map[string]any)
+		}
+		key := segment
+		for mKey := range m {
+			if strings.EqualFold(envName(mKey), envName(segment)) {
+				key = mKey
+				break
+			}
+		}
+		var elemType reflect.Type
+		if t.Kind() == reflect.Map {
+			elemType = t.Elem()
+		}
+		var err error
+		m[key], err = setEnvEntry(m[key], elemType, segments[1:], val)
+		return m, err
+	default:
+		return nil, fmt.Errorf("can't set: %s, in a value of type: %s", segment, t)
+	}
+}
+
+// envName replaces any character other than letters and digits with _, like in the name of an env var.
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// typeAtPath returns the type of the value at the path of keys inside a value of type t, or nil if it is unknown.
+func typeAtPath(t reflect.Type, keys []string) reflect.Type {
+	for _, key := range keys {
+		t = derefType(t)
+		switch t.Kind() {
+		case reflect.Struct:
+			field, found := t.FieldByNameFunc(func(name string) bool {
+				return strings.EqualFold(name, key)
+			})
+			if !found {
+				return nil
+			}
+			t = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+	return t
+}
+
+// derefType returns the type pointed by t, or an interface type if t is nil, so its kind can always be checked.
+func derefType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return reflect.TypeOf((*any)(nil)).Elem()
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// secretRefEntry is a secret reference and the keys of the path where it was found.
+type secretRefEntry struct {
+	keys []string
+	ref  string
+}
+
+// extractSecretRefs removes the secret references from confMap, and returns them with their path.
+func extractSecretRefs(keys []string, confMap map[string]any) []secretRefEntry {
+	var entries []secretRefEntry
+	for key, val := range confMap {
+		entryKeys := append(slices.Clone(keys), key)
+		switch v := val.(type) {
+		case map[string]any:
+			entries = append(entries, extractSecretRefs(entryKeys, v)...)
+		case string:
+			if isSecretRef(v) {
+				entries = append(entries, secretRefEntry{keys: entryKeys, ref: v})
+				delete(confMap, key)
+			}
+		}
+	}
+	return entries
+}
+
+// setPathFold sets the value at the path of confMap, matching the keys case-insensitively and creating the missing
+// maps.
+func setPathFold(confMap map[string]any, keys []string, val any) {
+	m := confMap
+	for i, key := range keys {
+		if mKey, found := findKeyFold(m, key); found {
+			key = mKey
+		}
+		if i == len(keys)-1 {
+			m[key] = val
 			return
 		}
+		subMap, ok := m[key].(map[string]any)
+		if !ok {
+			subMap = make(map[string]any)
+			m[key] = subMap
+		}
+		m = subMap
+	}
+}
+
+// loadSecrets returns a preprocess function that replaces the secret references with their values, see parseSecretRef.
+// It returns a LoadError for every key whose secret failed to load.
+func loadSecrets(conf RootConfig, secretsMgr SecretsManager) func(map[string]any) []*LoadError {
+	return func(confMap map[string]any) []*LoadError {
+		if conf.Env.Type == EnvTypeTest {
+			return nil
+		}
 		ctx := context.Background()
 
+		type fetchResult struct {
+			secret string
+			err    error
+		}
+		// Several keys can reference the same secret, for example to extract different fields, so they are fetched once
+		fetched := make(map[secretRef]fetchResult)
+		getSecret := func(ref secretRef) (secret string, err error) {
+			if result, present := fetched[ref]; present {
+				return result.secret, result.err
+			}
+			defer func() {
+				// Some SecretsManagers panic, like PanicSecretsManager
+				if r := recover(); r != nil {
+					err = errors.Newf(errors.ErrCodePanic, "panic getting secret: %v", r)
+				}
+				fetched[ref] = fetchResult{secret: secret, err: err}
+			}()
+			if ref.verbatim {
+				return secretsMgr.GetSecretVerbatim(ctx, ref.id)
+			}
+			return secretsMgr.GetSecret(ctx, ref.id)
+		}
+
+		var loadErrs []*LoadError
 		var traverse func(string, map[string]any)
 		traverse = func(prefix string, m map[string]any) {
-			for key, val := range m {
-				key = prefix + key
+			for mapKey, val := range m {
+				key := prefix + mapKey
 				switch v := val.(type) {
 				case map[string]any:
 					traverse(key+".", v)
 				case string:
-					if !strings.HasPrefix(v, "<secret") || !strings.HasSuffix(v, ">") {
+					if !isSecretRef(v) {
 						continue
 					}
 
-					var smKey, secret string
-					var err error
-					if v == "<secret>" {
-						smKey = key
-						secret, err = secretsMgr.GetSecret(ctx, smKey)
-					} else if v[7] == ':' {
-						smKey = v[8 : len(v)-1]
-						if smKey == "" {
-							panic(errors.Newf(
-								errors.ErrCodeBadState,
-								"invalid secret value: %s, for key: %s, provide a custom key or remove ':'",
-								v,
-								key,
-							))
-						}
-						secret, err = secretsMgr.GetSecretVerbatim(ctx, smKey)
-					} else {
-						panic(errors.Newf(errors.ErrCodeBadState, "invalid secret value: %s, for key: %s", v, key))
+					ref, jsonPath, err := parseSecretRef(key, v)
+					if err != nil {
+						loadErrs = append(loadErrs, &LoadError{Path: yamlPath(key), Source: SourceSecret, Err: err})
+						continue
+					}
+					// The redacted secrets are not fetched, nor extracted, as they are not JSON
+					if _, redacted := secretsMgr.(RedactedSecretsManager); redacted {
+						m[mapKey] = RedactedValue
+						continue
 					}
+					secret, err := getSecret(ref)
 					if err != nil {
-						panic(errors.NewUnknownf("could not load secret: %s, error: %w", smKey, err))
+						loadErrs = append(loadErrs, &LoadError{
+							Path:   yamlPath(key),
+							Source: SourceSecret,
+							Err:    errors.NewUnknownf("could not load secret: %s, error: %w", ref.id, err),
+						})
+						continue
+					}
+					if jsonPath != "" {
+						secret, err = extractJSONPath(secret, jsonPath)
+						if err != nil {
+							loadErrs = append(loadErrs, &LoadError{
+								Path:   yamlPath(key),
+								Source: SourceSecret,
+								Err: errors.Newf(
+									errors.ErrCodeBadState,
+									"could not extract: %s from secret: %s, error: %w",
+									jsonPath,
+									ref.id,
+									err,
+								),
+							})
+							continue
+						}
 					}
-					m[key] = secret
+					m[mapKey] = secret
 				}
 			}
 		}
 		traverse("", confMap)
+		slices.SortFunc(loadErrs, func(a, b *LoadError) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+		return loadErrs
 	}
 }
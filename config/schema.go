@@ -0,0 +1,281 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// SchemaVersion is the JSON Schema dialect of the schemas generated by Schema.
+const SchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+// Enumer is implemented by the config types that only accept a fixed set of values. The values are listed in the JSON
+// Schema generated by Schema.
+type Enumer interface {
+	Enum() []string
+}
+
+const (
+	secretRefDef     = "secretRef"
+	durationPattern  = `^([-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+$|^0$`
+	secretRefPattern = `^<secret(:[^#>]+)?(#[^>]+)?>$`
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	enumerType          = reflect.TypeOf((*Enumer)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+/*
+Schema generates a JSON Schema for the config files of the config struct conf, which can be a value or a pointer, like
+Schema(Config{}). Editors can use it to autocomplete and validate the config files, and CI to lint them.
+
+The schema follows the rules used to load the config:
+  - The keys are the YAML names of the fields, like httpServer, and they are also matched case-insensitively.
+  - Embedded structs are squashed.
+  - Lists also accept a comma separated string, and durations a string like "30s".
+  - The values of the DefaultTagName tags are the defaults, and the oneof, min and max rules of the ValidateTagName tags
+    are included.
+  - Types that implement Enumer list their values.
+  - Any value can be a reference to a secret, like <secret:db#password>, see the "secretRef" definition.
+*/
+func Schema(conf any) map[string]any {
+	t := reflect.TypeOf(conf)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	schema := schemaForType(t, "#")
+	schema["$schema"] = SchemaVersion
+	schema["title"] = t.String()
+	schema["$defs"] = map[string]any{
+		secretRefDef: map[string]any{
+			"type":        "string",
+			"pattern":     secretRefPattern,
+			"description": "Reference to a secret: <secret>, <secret:id>, <secret#path> or <secret:id#path>",
+		},
+	}
+	return schema
+}
+
+// WriteSchema writes the JSON Schema of conf, see Schema, as indented JSON.
+func WriteSchema(w io.Writer, conf any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(Schema(conf)); err != nil {
+		return errors.NewUnknownf("failed to write config schema, error: %w", err)
+	}
+	return nil
+}
+
+// schemaForType returns the schema of t. The pointer is the JSON pointer of the returned schema inside the root schema.
+func schemaForType(t reflect.Type, pointer string) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Implements(enumerType) || reflect.PointerTo(t).Implements(enumerType) {
+		enumer := reflect.New(t).Interface().(Enumer)
+		return withSecretRef(map[string]any{"type": "string", "enum": enumer.Enum()})
+	}
+	if t == durationType {
+		return withSecretRef(map[string]any{
+			"type":    []string{"string", "integer"},
+			"pattern": durationPattern,
+		})
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return withSecretRef(map[string]any{"type": "string"})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, pointer)
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": schemaForType(t.Elem(), pointer+"/additionalProperties"),
+		}
+	case reflect.Slice, reflect.Array:
+		// Lists can also be set with a comma separated string
+		return map[string]any{
+			"anyOf": []any{
+				map[string]any{"type": "array", "items": schemaForType(t.Elem(), pointer+"/anyOf/0/items")},
+				map[string]any{"type": "string"},
+			},
+		}
+	case reflect.Bool:
+		return withSecretRef(map[string]any{"type": "boolean"})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return withSecretRef(map[string]any{"type": "integer"})
+	case reflect.Float32, reflect.Float64:
+		return withSecretRef(map[string]any{"type": "number"})
+	case reflect.String:
+		return withSecretRef(map[string]any{"type": "string"})
+	default:
+		// Interfaces accept anything
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema of the struct t, with one property for every field, and a case-insensitive pattern
+// property that references it.
+func structSchema(t reflect.Type, pointer string) map[string]any {
+	properties := make(map[string]any)
+	patternProperties := make(map[string]any)
+	for _, field := range schemaFields(t) {
+		key := yamlKey(field.Name)
+		propertyPointer := pointer + "/properties/" + escapeJSONPointer(key)
+		property := schemaForType(field.Type, propertyPointer)
+		if defaultVal, ok := field.Tag.Lookup(DefaultTagName); ok {
+			property["default"] = schemaDefault(field.Type, defaultVal)
+		}
+		if tag, ok := field.Tag.Lookup(ValidateTagName); ok {
+			addValidateRules(property, field.Type, tag)
+		}
+		properties[key] = property
+		patternProperties[caseInsensitivePattern(key)] = map[string]any{"$ref": propertyPointer}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    patternProperties,
+		"additionalProperties": false,
+	}
+}
+
+// schemaFields returns the exported fields of t that can be set from the config files, squashing the embedded structs.
+func schemaFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		default:
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, schemaFields(field.Type)...)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// withSecretRef allows a secret reference in place of the value of the schema.
+func withSecretRef(schema map[string]any) map[string]any {
+	return map[string]any{
+		"anyOf": []any{schema, map[string]any{"$ref": "#/$defs/" + secretRefDef}},
+	}
+}
+
+// valueSchema returns the schema of the value, without the secret reference alternative added by withSecretRef.
+func valueSchema(schema map[string]any) map[string]any {
+	if anyOf, ok := schema["anyOf"].([]any); ok && len(anyOf) > 0 {
+		if first, ok := anyOf[0].(map[string]any); ok {
+			return first
+		}
+	}
+	return schema
+}
+
+// schemaDefault converts the default tag value to the JSON type of the field, it is kept as a string if it fails.
+func schemaDefault(t reflect.Type, defaultVal string) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return defaultVal
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(defaultVal); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(defaultVal, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseUint(defaultVal, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(defaultVal, 64); err == nil {
+			return n
+		}
+	case reflect.Slice, reflect.Array:
+		items := []any{}
+		for _, item := range strings.Split(defaultVal, ",") {
+			items = append(items, schemaDefault(t.Elem(), item))
+		}
+		return items
+	default:
+	}
+	return defaultVal
+}
+
+// addValidateRules adds the oneof, min and max rules of the ValidateTagName tag to the schema of the value. Invalid
+// rules are skipped, they are reported by Validate.
+func addValidateRules(schema map[string]any, t reflect.Type, tag string) {
+	schema = valueSchema(schema)
+	for _, rawRule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rawRule), "=")
+		switch name {
+		case "oneof":
+			schema["enum"] = strings.Split(arg, "|")
+		case "min", "max":
+			if t == durationType || schema["type"] == "string" {
+				continue
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			if name == "min" {
+				schema["minimum"] = n
+			} else {
+				schema["maximum"] = n
+			}
+		default:
+		}
+	}
+}
+
+// caseInsensitivePattern returns a regular expression that matches the key ignoring the case. The flags of the
+// expressions are not portable across JSON Schema validators, so every letter is matched with a class, like: [aA]
+func caseInsensitivePattern(key string) string {
+	buf := strings.Builder{}
+	buf.WriteString("^")
+	for _, r := range key {
+		lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+		if lower == upper {
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			continue
+		}
+		buf.WriteString("[")
+		buf.WriteRune(lower)
+		buf.WriteRune(upper)
+		buf.WriteString("]")
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
 
 	"github.com/southernlabs-io/go-fw/errors"
 )
@@ -22,3 +25,97 @@ func (w PanicSecretsManager) GetSecret(_ context.Context, name string) (string,
 func (w PanicSecretsManager) GetSecretVerbatim(_ context.Context, id string) (string, error) {
 	panic(errors.Newf(errors.ErrCodeBadState, "no SecretsManager provided, but trying to get secret for key: %s", id))
 }
+
+// RedactedSecretsManager resolves every secret to RedactedValue, without extracting the JSON path of the references, so
+// the config can be loaded, and written with WriteConfig, without access to the secrets.
+type RedactedSecretsManager struct {
+}
+
+func (RedactedSecretsManager) GetSecret(_ context.Context, _ string) (string, error) {
+	return RedactedValue, nil
+}
+
+func (RedactedSecretsManager) GetSecretVerbatim(_ context.Context, _ string) (string, error) {
+	return RedactedValue, nil
+}
+
+// secretRef identifies a secret in the SecretsManager. If verbatim is true, the id must be used as is, otherwise it is a
+// key that the SecretsManager transforms.
+type secretRef struct {
+	id       string
+	verbatim bool
+}
+
+// isSecretRef returns true if the value references a secret, see parseSecretRef for the formats.
+func isSecretRef(v string) bool {
+	return strings.HasPrefix(v, "<secret") && strings.HasSuffix(v, ">")
+}
+
+// parseSecretRef parses a secret reference found at the config key. The supported formats are:
+//   - <secret>: the key is used as the secret key.
+//   - <secret:custom_key>: the custom_key is used verbatim as the secret id.
+//   - <secret#path> and <secret:custom_key#path>: the secret is parsed as JSON and the value at path is extracted.
+//
+// It returns the secret reference and the JSON path, which is empty if there is none.
+func parseSecretRef(key, v string) (secretRef, string, error) {
+	inner := v[len("<secret") : len(v)-1]
+	inner, jsonPath, hasPath := strings.Cut(inner, "#")
+	if hasPath && jsonPath == "" {
+		return secretRef{}, "", errors.Newf(
+			errors.ErrCodeBadState,
+			"invalid secret value: %s, for key: %s, provide a path or remove '#'",
+			v,
+			key,
+		)
+	}
+	switch {
+	case inner == "":
+		return secretRef{id: key}, jsonPath, nil
+	case inner[0] == ':':
+		if len(inner) == 1 {
+			return secretRef{}, "", errors.Newf(
+				errors.ErrCodeBadState,
+				"invalid secret value: %s, for key: %s, provide a custom key or remove ':'",
+				v,
+				key,
+			)
+		}
+		return secretRef{id: inner[1:], verbatim: true}, jsonPath, nil
+	default:
+		return secretRef{}, "", errors.Newf(errors.ErrCodeBadState, "invalid secret value: %s, for key: %s", v, key)
+	}
+}
+
+// extractJSONPath parses the secret as JSON and returns the value at the path, whose segments are separated by dots.
+// Segments are object keys or array indexes. Strings are returned as is, any other value is returned as JSON.
+func extractJSONPath(secret string, jsonPath string) (string, error) {
+	var val any
+	if err := json.Unmarshal([]byte(secret), &val); err != nil {
+		return "", errors.NewUnknownf("secret is not valid JSON, error: %w", err)
+	}
+	for _, segment := range strings.Split(jsonPath, ".") {
+		switch v := val.(type) {
+		case map[string]any:
+			var present bool
+			if val, present = v[segment]; !present {
+				return "", errors.Newf(errors.ErrCodeNotFound, "key not found: %s", segment)
+			}
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return "", errors.Newf(errors.ErrCodeNotFound, "invalid index: %s, for array of length: %d", segment, len(v))
+			}
+			val = v[idx]
+		default:
+			return "", errors.Newf(errors.ErrCodeNotFound, "can't get: %s, from a value that is not an object or array", segment)
+		}
+	}
+	if str, ok := val.(string); ok {
+		return str, nil
+	}
+	jsonBytes, err := json.Marshal(val)
+	if err != nil {
+		return "", errors.NewUnknownf("failed to marshal value, error: %w", err)
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// Source is where a config value was taken from.
+type Source string
+
+const (
+	SourceYAML    Source = "yaml"
+	SourceDotEnv  Source = "dotenv"
+	SourceEnv     Source = "env"
+	SourceSecret  Source = "secret"
+	SourceDefault Source = "default"
+)
+
+// Sources maps the path of every config value, like: httpServer.port, to the Source it was taken from. Paths are case
+// insensitive. Values that were not set by any source are not present.
+type Sources map[string]Source
+
+// Set sets the source of the value at path.
+func (s Sources) Set(path string, source Source) {
+	s[strings.ToLower(path)] = source
+}
+
+// Of returns the source of the value at path, or an empty Source if it was not set.
+func (s Sources) Of(path string) Source {
+	return s[strings.ToLower(path)]
+}
+
+// setAll sets the source of every leaf value in confMap.
+func (s Sources) setAll(confMap map[string]any, source Source) {
+	walkLeaves("", confMap, func(path string, _ any) {
+		s.Set(path, source)
+	})
+}
+
+// setMissing sets the source of the leaf values in confMap that don't have a source yet.
+func (s Sources) setMissing(confMap map[string]any, source Source) {
+	walkLeaves("", confMap, func(path string, _ any) {
+		if s.Of(path) == "" {
+			s.Set(path, source)
+		}
+	})
+}
+
+// setSecrets sets SourceSecret for the values in confMap that reference a secret.
+func (s Sources) setSecrets(confMap map[string]any) {
+	walkLeaves("", confMap, func(path string, val any) {
+		if str, ok := val.(string); ok && isSecretRef(str) {
+			s.Set(path, SourceSecret)
+		}
+	})
+}
+
+func walkLeaves(path string, m map[string]any, f func(path string, val any)) {
+	for key, val := range m {
+		if subMap, ok := val.(map[string]any); ok {
+			walkLeaves(joinPath(path, key), subMap, f)
+		} else {
+			f(joinPath(path, key), val)
+		}
+	}
+}
+
+func deepCopyMap(m map[string]any) map[string]any {
+	copied := make(map[string]any, len(m))
+	for key, val := range m {
+		if subMap, ok := val.(map[string]any); ok {
+			val = deepCopyMap(subMap)
+		}
+		copied[key] = val
+	}
+	return copied
+}
+
+type OutputFormat string
+
+const (
+	OutputFormatYAML OutputFormat = "yaml"
+	OutputFormatJSON OutputFormat = "json"
+)
+
+// RedactedValue replaces the values taken from secrets when the config is written with WriteConfig.
+const RedactedValue = "<redacted>"
+
+/*
+WriteConfig writes the conf to w in the given format, annotating each value with its source. Values taken from
+secrets are replaced with RedactedValue.
+
+With OutputFormatYAML the source is added as a comment next to each value:
+
+	httpServer:
+	  port: 9090 # env
+
+With OutputFormatJSON the output is an object with two keys: "config", with the values, and "sources", with the source
+of each value by path.
+*/
+func WriteConfig(w io.Writer, conf any, sources Sources, format OutputFormat) error {
+	outputSources := map[string]Source{}
+	node, err := describeValue("", reflect.ValueOf(conf), sources, outputSources)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case OutputFormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err = encoder.Encode(node); err != nil {
+			return errors.NewUnknownf("failed to encode config to yaml, error: %w", err)
+		}
+		return encoder.Close()
+	case OutputFormatJSON:
+		var confVal any
+		if err = node.Decode(&confVal); err != nil {
+			return errors.NewUnknownf("failed to decode config node, error: %w", err)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]any{"config": confVal, "sources": outputSources})
+		if err != nil {
+			return errors.NewUnknownf("failed to encode config to json, error: %w", err)
+		}
+		return nil
+	default:
+		return errors.Newf(errors.ErrCodeBadArgument, "unsupported output format: %s", format)
+	}
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// describeValue converts v to a yaml.Node, using the YAML names of the fields, and annotating the values with their
+// source. The sources found are added to outputSources.
+func describeValue(path string, v reflect.Value, sources Sources, outputSources map[string]Source) (*yaml.Node, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+		}
+		v = v.Elem()
+	}
+
+	if isMarshaler(v.Type()) {
+		// Values with custom marshaling are converted with JSON, which is what is used to load them
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		jsonBytes, err := json.Marshal(ptr.Interface())
+		if err != nil {
+			return nil, errors.NewUnknownf("failed to marshal config value: %s, error: %w", path, err)
+		}
+		var generic any
+		if err = json.Unmarshal(jsonBytes, &generic); err != nil {
+			return nil, errors.NewUnknownf("failed to unmarshal config value: %s, error: %w", path, err)
+		}
+		return describeValue(path, reflect.ValueOf(generic), sources, outputSources)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if err := describeFields(path, v, node, sources, outputSources); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, key := range keys {
+			err := addEntry(node, path, fmt.Sprint(key.Interface()), v.MapIndex(key), sources, outputSources)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+		}
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			elemNode, err := describeValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), sources, outputSources)
+			if err != nil {
+				return nil, err
+			}
+			if elemNode.Kind != yaml.ScalarNode {
+				node.Style = 0
+			}
+			node.Content = append(node.Content, elemNode)
+		}
+		return node, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, errors.NewUnknownf("failed to encode config value: %s, error: %w", path, err)
+		}
+		return node, nil
+	}
+}
+
+func describeFields(path string, v reflect.Value, node *yaml.Node, sources Sources, outputSources map[string]Source) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		default:
+		}
+		// Embedded structs are squashed, so their fields are at the same level
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !isMarshaler(field.Type) {
+			if err := describeFields(path, v.Field(i), node, sources, outputSources); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := addEntry(node, path, yamlKey(field.Name), v.Field(i), sources, outputSources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEntry adds the key and its value to the mapping node, redacting it if it was taken from a secret.
+func addEntry(
+	node *yaml.Node,
+	path string,
+	key string,
+	v reflect.Value,
+	sources Sources,
+	outputSources map[string]Source,
+) error {
+	entryPath := joinPath(path, key)
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+	source := sources.Of(entryPath)
+
+	var valueNode *yaml.Node
+	if source == SourceSecret {
+		valueNode = &yaml.Node{Kind: yaml.ScalarNode, Value: RedactedValue}
+	} else {
+		var err error
+		valueNode, err = describeValue(entryPath, v, sources, outputSources)
+		if err != nil {
+			return err
+		}
+	}
+	if source != "" {
+		outputSources[entryPath] = source
+		if valueNode.Kind == yaml.ScalarNode || valueNode.Style == yaml.FlowStyle {
+			valueNode.LineComment = string(source)
+		} else {
+			keyNode.LineComment = string(source)
+		}
+	}
+	node.Content = append(node.Content, keyNode, valueNode)
+	return nil
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// ValidateTagName is the struct tag used to declare validation rules on config fields.
+//
+// The supported rules, separated by comma, are:
+//   - required: the value must not be empty.
+//   - min=<n>: the value must be greater or equal to n. Durations are expressed like "1s".
+//   - max=<n>: the value must be less or equal to n. Durations are expressed like "1s".
+//   - oneof=<a>|<b>|...: the value must be one of the given values.
+//
+// Rules other than required are skipped for empty values. Example:
+//
+//	type MyConfig struct {
+//		URL     string        `validate:"required"`
+//		Timeout time.Duration `validate:"min=1s,max=1m"`
+//		Mode    string        `validate:"oneof=fast|safe"`
+//	}
+const ValidateTagName = "validate"
+
+// ValidationConfig configures the validation of the configuration done when it is loaded.
+type ValidationConfig struct {
+	// StrictKeys makes keys in the config files that don't match any field an error instead of a warning.
+	StrictKeys bool
+}
+
+// Violation is a single validation failure.
+type Violation struct {
+	// Path is the YAML path of the value, like: httpServer.port
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// Validate validates the config struct using the ValidateTagName struct tags and the validation.Validatable interface,
+// which is called on every struct, map, slice or value that implements it. All the violations are reported together in
+// one error with code errors.ErrCodeValidationFailed. It returns nil if the config is valid.
+func Validate(conf any) error {
+	return newValidationError(conf, validateValue("", reflect.ValueOf(conf), true))
+}
+
+func newValidationError(conf any, violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	slices.SortFunc(violations, func(a, b Violation) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	buf := strings.Builder{}
+	for _, violation := range violations {
+		buf.WriteString("\n  - ")
+		buf.WriteString(violation.String())
+	}
+	return errors.Newf(
+		errors.ErrCodeValidationFailed,
+		"invalid config: %T, %d violations:%s",
+		conf,
+		len(violations),
+		buf.String(),
+	)
+}
+
+var validatableType = reflect.TypeOf((*validation.Validatable)(nil)).Elem()
+
+// validateValue validates v and its children. The validation.Validatable of v is only called if callValidatable is true,
+// which is false for embedded structs, because their Validate method is promoted to the parent.
+func validateValue(path string, v reflect.Value, callValidatable bool) []Violation {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var violations []Violation
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPath := path
+			// Embedded structs are squashed, so their fields are at the same level
+			if !field.Anonymous || field.Type.Kind() != reflect.Struct {
+				fieldPath = joinPath(path, yamlKey(field.Name))
+			}
+			fieldValue := v.Field(i)
+			if tag, ok := field.Tag.Lookup(ValidateTagName); ok {
+				violations = append(violations, validateTag(fieldPath, fieldValue, tag)...)
+			}
+			violations = append(violations, validateValue(fieldPath, fieldValue, !field.Anonymous)...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			violations = append(violations, validateValue(joinPath(path, fmt.Sprint(iter.Key().Interface())), iter.Value(), true)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			violations = append(violations, validateValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), true)...)
+		}
+	default:
+	}
+
+	if !callValidatable {
+		return violations
+	}
+	return append(violations, validateValidatable(path, v)...)
+}
+
+// validateValidatable calls validation.Validatable.Validate if the value, or a pointer to it, implements it.
+func validateValidatable(path string, v reflect.Value) []Violation {
+	var validatable validation.Validatable
+	if v.Type().Implements(validatableType) {
+		validatable = v.Interface().(validation.Validatable)
+	} else if reflect.PointerTo(v.Type()).Implements(validatableType) {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		validatable = ptr.Interface().(validation.Validatable)
+	} else {
+		return nil
+	}
+	return toViolations(path, validatable.Validate())
+}
+
+// toViolations flattens validation.Errors into violations, converting the field names to YAML paths.
+func toViolations(path string, err error) []Violation {
+	if err == nil {
+		return nil
+	}
+	var vErrs validation.Errors
+	if !errors.As(err, &vErrs) {
+		if path == "" {
+			path = "."
+		}
+		return []Violation{{Path: path, Message: err.Error()}}
+	}
+	var violations []Violation
+	for key, vErr := range vErrs {
+		violations = append(violations, toViolations(joinPath(path, yamlKey(key)), vErr)...)
+	}
+	return violations
+}
+
+func validateTag(path string, v reflect.Value, tag string) []Violation {
+	var rules []validation.Rule
+	for _, rawRule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rawRule), "=")
+		var rule validation.Rule
+		var err error
+		switch name {
+		case "":
+			continue
+		case "required":
+			rule = validation.Required
+		case "min":
+			var threshold any
+			threshold, err = parseThreshold(v.Type(), arg)
+			rule = validation.Min(threshold)
+		case "max":
+			var threshold any
+			threshold, err = parseThreshold(v.Type(), arg)
+			rule = validation.Max(threshold)
+		case "oneof":
+			var options []any
+			for _, option := range strings.Split(arg, "|") {
+				var value any
+				if value, err = parseArg(v.Type(), option); err != nil {
+					break
+				}
+				options = append(options, value)
+			}
+			rule = validation.In(options...)
+		default:
+			err = fmt.Errorf("unknown rule: %s", name)
+		}
+		if err != nil {
+			return []Violation{{Path: path, Message: fmt.Sprintf("invalid %s tag: %q, error: %s", ValidateTagName, tag, err)}}
+		}
+		rules = append(rules, rule)
+	}
+	// The rules are called directly, because validation.Validate would also call validation.Validatable
+	value := v.Interface()
+	for _, rule := range rules {
+		if err := rule.Validate(value); err != nil {
+			return []Violation{{Path: path, Message: err.Error()}}
+		}
+	}
+	return nil
+}
+
+// parseThreshold parses the min/max argument into the type of the field, so they can be compared.
+func parseThreshold(t reflect.Type, arg string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if kind := t.Kind(); kind == reflect.String || kind == reflect.Bool {
+		return nil, fmt.Errorf("unsupported type: %s", t)
+	}
+	return parseArg(t, arg)
+}
+
+// parseArg parses the argument of a rule into the type of the field, or the type it points to, as the rules compare
+// the value it points to.
+func parseArg(t reflect.Type, arg string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return time.ParseDuration(arg)
+	}
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(arg)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return nil, err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(arg, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(arg, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(arg, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		value.SetFloat(n)
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", t)
+	}
+	return value.Interface(), nil
+}
+
+// yamlKey converts a field name to the key used in the config files, lowering the leading capital letters or acronym,
+// like: HttpServer -> httpServer, HTTPTimeoutSeconds -> httpTimeoutSeconds, JWT -> jwt
+func yamlKey(fieldName string) string {
+	runes := []rune(fieldName)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// The last capital letter of an acronym starts the next word
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// embedsConfig returns true if the type is a struct that embeds Config, directly or indirectly.
+func embedsConfig(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && (field.Type == reflect.TypeOf(Config{}) || embedsConfig(field.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnknownKeys returns a violation for every unknown key if StrictKeys is enabled, otherwise it logs a warning.
+//
+// The keys are checked for Config, and for the structs that embed it, which are expected to hold all the keys of the
+// app. As the apps that extend Config also load it, see configUnknownKeys.
+func checkUnknownKeys(conf any, validationConf ValidationConfig, unknownKeys []string) []Violation {
+	confType := reflect.TypeOf(conf)
+	for confType.Kind() == reflect.Pointer {
+		confType = confType.Elem()
+	}
+	if confType == reflect.TypeOf(Config{}) {
+		unknownKeys = configUnknownKeys(confType, unknownKeys)
+	} else if !embedsConfig(confType) {
+		return nil
+	}
+	if len(unknownKeys) == 0 {
+		return nil
+	}
+	// The parents of the unknown key are reported with the field names, they are converted to YAML paths
+	for i, key := range unknownKeys {
+		if lastDot := strings.LastIndex(key, "."); lastDot != -1 {
+			parents := strings.Split(key[:lastDot], ".")
+			for j, parent := range parents {
+				parents[j] = yamlKey(parent)
+			}
+			unknownKeys[i] = strings.Join(parents, ".") + key[lastDot:]
+		}
+	}
+	slices.Sort(unknownKeys)
+	if !validationConf.StrictKeys {
+		slog.Default().Warn(fmt.Sprintf(
+			"[%T] Unknown config keys, they don't match any field: %s",
+			conf,
+			strings.Join(unknownKeys, ", "),
+		))
+		return nil
+	}
+	violations := make([]Violation, 0, len(unknownKeys))
+	for _, key := range unknownKeys {
+		violations = append(violations, Violation{Path: key, Message: "unknown key, it doesn't match any field"})
+	}
+	return violations
+}
+
+// configUnknownKeys returns the unknown keys of Config that can't be keys of an app that extends it: the keys inside of
+// the sections of Config, and the top level keys that look like a typo of one of its sections, like htpServer.
+func configUnknownKeys(confType reflect.Type, unknownKeys []string) []string {
+	var keys []string
+	for _, key := range unknownKeys {
+		if strings.Contains(key, ".") {
+			keys = append(keys, key)
+			continue
+		}
+		for _, field := range reflect.VisibleFields(confType) {
+			if !field.Anonymous && isTypo(key, yamlKey(field.Name)) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// isTypo returns true if the key differs from the known one in one character, or in two for keys longer than 4.
+func isTypo(key, known string) bool {
+	maxDistance := 2
+	if len(known) <= 4 {
+		maxDistance = 1
+	}
+	a, b := []rune(strings.ToLower(key)), []rune(strings.ToLower(known))
+	// Levenshtein distance, with one row of the matrix
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := diagonal
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			diagonal = row[j]
+			row[j] = min(row[j]+1, row[j-1]+1, substitution)
+		}
+	}
+	return row[len(b)] <= maxDistance
+}
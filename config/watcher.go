@@ -0,0 +1,240 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+// DefaultWatchInterval is the interval used by the Watcher to check the config files for changes.
+const DefaultWatchInterval = 5 * time.Second
+
+// ConfigChangeHandler is called with the previous and the new Config after a successful reload.
+type ConfigChangeHandler func(old, new Config)
+
+/*
+Watcher watches the resolved chain of config files and the .env file, and reloads the Config when any of them changes.
+Subscribers are notified with the old and the new values, and they are responsible for applying the changes.
+
+The framework applies these changes live when the Watcher is provided with ModuleWatcher:
+  - Log.Level and Log.Levels: updates the level of all loggers created by the log.LoggerFactory.
+  - HttpServer.CORS: rebuilds the CORS handler of the rest.HTTPHandler.
+  - Slack: updates the webhook URLs, the HTTP timeout and the enabled flag of the slack.Client.
+  - Database.User and Database.Pass: used by the new connections of the database.DB.
+
+Any other change requires a restart to take effect.
+*/
+type Watcher struct {
+	secretsMgr SecretsManager
+	interval   time.Duration
+
+	mu          sync.Mutex
+	current     Config
+	modTimes    map[string]time.Time
+	subscribers []ConfigChangeHandler
+
+	stopChn chan struct{}
+	doneChn chan struct{}
+}
+
+// NewWatcher creates a new Watcher that starts from the given Config. The secretsMgr is used to resolve secrets on
+// every reload, it can be nil if no secrets are used.
+func NewWatcher(conf Config, secretsMgr SecretsManager) *Watcher {
+	if secretsMgr == nil {
+		secretsMgr = PanicSecretsManager{}
+	}
+	w := &Watcher{
+		secretsMgr: secretsMgr,
+		interval:   DefaultWatchInterval,
+		current:    conf,
+	}
+	w.modTimes = w.statFiles()
+	return w
+}
+
+// Config returns the latest successfully loaded Config.
+func (w *Watcher) Config() Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers a handler to be called after every successful reload.
+func (w *Watcher) Subscribe(handler ConfigChangeHandler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, handler)
+}
+
+// SetInterval sets the interval used to check the files for changes. It must be called before Start.
+func (w *Watcher) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// Start starts checking the config files for changes in the background.
+func (w *Watcher) Start() {
+	w.stopChn = make(chan struct{})
+	w.doneChn = make(chan struct{})
+	go func() {
+		defer close(w.doneChn)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stopChn:
+				return
+			case <-ticker.C:
+				modTimes := w.statFiles()
+				if w.changed(modTimes) {
+					if err := w.Reload(); err != nil {
+						slog.Default().Error(fmt.Sprintf("[%T] Failed to reload config, keeping the current one: %s", w, err))
+					}
+					w.mu.Lock()
+					w.modTimes = modTimes
+					w.mu.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking the config files for changes. It blocks until the background routine is done.
+func (w *Watcher) Stop() {
+	if w.stopChn == nil {
+		return
+	}
+	close(w.stopChn)
+	<-w.doneChn
+	w.stopChn = nil
+}
+
+// Reload loads the .env and config files from disk into a fresh Config, and notifies the subscribers if it
+// succeeds. On failure, including an invalid Config, the current Config is kept and an error is returned.
+func (w *Watcher) Reload() error {
+	newConf, err := w.load()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	oldConf := w.current
+	w.current = newConf
+	subscribers := append([]ConfigChangeHandler(nil), w.subscribers...)
+	w.mu.Unlock()
+
+	slog.Default().Info(fmt.Sprintf("[%T] Config reloaded, notifying %d subscribers", w, len(subscribers)))
+	for _, subscriber := range subscribers {
+		w.notify(subscriber, oldConf, newConf)
+	}
+	return nil
+}
+
+// notify calls the subscriber recovering from any panic, so one failing subscriber does not affect the others.
+func (w *Watcher) notify(subscriber ConfigChangeHandler, oldConf, newConf Config) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Default().Error(fmt.Sprintf("[%T] Subscriber panicked while applying config changes: %v", w, r))
+		}
+	}()
+	subscriber(oldConf, newConf)
+}
+
+func (w *Watcher) load() (conf Config, err error) {
+	// A panic decoding the files, or validating them, must not bring the app down
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr, ok := r.(error)
+			if !ok {
+				panicErr = errors.Newf(errors.ErrCodePanic, "%v", r)
+			}
+			err = newLoadError(&conf, []*LoadError{{
+				Err: errors.Newf(errors.ErrCodePanic, "panic reloading config: %w", panicErr),
+			}})
+		}
+	}()
+
+	dotEnvPath, err := findConfigFile(".env")
+	if err == nil {
+		if err = applyDotEnv(dotEnvPath); err != nil {
+			return conf, errors.NewUnknownf("failed to load dot env file: %s, error: %w", dotEnvPath, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return conf, errors.NewUnknownf("failed to find dot env file, error: %w", err)
+	}
+
+	files, err := readConfigFiles()
+	if err != nil {
+		return conf, err
+	}
+	var root RootConfig
+	if _, err = decodeConfig(files, &root, nil, nil); err != nil {
+		return conf, err
+	}
+	conf = Config{RootConfig: root}
+	if _, err = decodeConfig(files, &conf, loadSecrets(root, w.secretsMgr), nil); err != nil {
+		return conf, err
+	}
+	if err = Validate(&conf); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+// statFiles returns the modification time of the config files that currently exist. The chain of config files is
+// resolved every time, so overlays that are added or removed are also detected.
+func (w *Watcher) statFiles() map[string]time.Time {
+	var filePaths []string
+	if files, err := resolveConfigFiles(); err == nil {
+		for _, file := range files {
+			filePaths = append(filePaths, file.path)
+		}
+	}
+	if dotEnvPath, err := findConfigFile(".env"); err == nil {
+		filePaths = append(filePaths, dotEnvPath)
+	}
+
+	modTimes := map[string]time.Time{}
+	for _, filePath := range filePaths {
+		if info, err := os.Stat(filePath); err == nil {
+			modTimes[filePath] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (w *Watcher) changed(modTimes map[string]time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(modTimes) != len(w.modTimes) {
+		return true
+	}
+	for filePath, modTime := range modTimes {
+		if prev, present := w.modTimes[filePath]; !present || !prev.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModuleWatcher provides a Watcher and starts it with the fx app. It must be used together with Module.
+var ModuleWatcher = fx.Provide(
+	fx.Annotate(
+		NewWatcher,
+		fx.ParamTags("", `optional:"true"`),
+		fx.OnStart(func(_ context.Context, w *Watcher) error {
+			w.Start()
+			return nil
+		}),
+		fx.OnStop(func(_ context.Context, w *Watcher) error {
+			w.Stop()
+			return nil
+		}),
+	),
+)
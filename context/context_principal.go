@@ -0,0 +1,5 @@
+package context
+
+// PrincipalCtxKey is the key of the principal of the request, set by the authentication middleware. It is here, and not
+// in the middleware, so the packages that the middleware imports, like the database, can read the principal.
+const PrincipalCtxKey = "authn_principal"
@@ -1,13 +1,18 @@
 package database
 
 import (
+	stdcontext "context"
 	"database/sql"
 	"fmt"
 	"math/rand"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/fx"
 	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
@@ -22,8 +27,9 @@ import (
 )
 
 var (
-	DBCtxKey   = context.CtxKey("_fw_db")
-	DBTxCtxKey = context.CtxKey("_fw_db_tx")
+	DBCtxKey         = context.CtxKey("_fw_db")
+	DBTxCtxKey       = context.CtxKey("_fw_db_tx")
+	DBReplicasCtxKey = context.CtxKey("_fw_db_replicas")
 )
 
 const (
@@ -34,9 +40,19 @@ const (
 type DB struct {
 	*gorm.DB
 	DbName string
+
+	// conf is the current config of the DB. Every new connection reads the credentials from it, so they can be rotated
+	// without reopening the DB, and RunInTx the retry settings.
+	conf *atomic.Pointer[config.DatabaseConfig]
+	// replicas are the read replicas, nil if there are none
+	replicas *Replicas
 }
 
+// CreateDBName returns config.DatabaseConfig.DBName if set, otherwise a name built from the app and env names.
 func CreateDBName(conf config.Config) string {
+	if conf.Database.DBName != "" {
+		return conf.Database.DBName
+	}
 	return strings.ReplaceAll(
 		strings.ToLower(fmt.Sprintf("%s_%s", conf.Name, conf.Env.Name)),
 		"-",
@@ -50,12 +66,115 @@ func NewDB(conf config.Config, lf *log.LoggerFactory) DB {
 		panic(errors.Newf(errors.ErrCodeBadState, "in a test: %+v", conf.Env))
 	}
 
-	dbName := CreateDBName(conf)
-	db := MustOpenGORM(conf, dbName, lf)
+	return OpenDB(conf, CreateDBName(conf), lf)
+}
+
+// OpenDB opens the database dbName, and its replicas, with the settings of conf.Database. It panics if it fails to
+// connect to the primary.
+func OpenDB(conf config.Config, dbName string, lf *log.LoggerFactory) DB {
+	dbConf := &atomic.Pointer[config.DatabaseConfig]{}
+	dbConf.Store(&conf.Database)
+	db := mustOpenGORM(conf, dbName, dbConf, lf, false)
 	return DB{
-		DB:     db,
-		DbName: dbName,
+		DB:       db,
+		DbName:   dbName,
+		conf:     dbConf,
+		replicas: newReplicas(conf, dbName, dbConf, lf),
+	}
+}
+
+// UpdateCredentials sets the user and password used by the new connections. The open connections keep using the
+// previous ones until they are closed by the pool. It does nothing if the DB was not created with OpenDB.
+func (d DB) UpdateCredentials(dbConf config.DatabaseConfig) {
+	if d.conf == nil {
+		return
+	}
+	d.conf.Store(&dbConf)
+}
+
+// defaultMaxIdleConns is the database/sql default, used when config.DatabaseConfig.MaxIdleConns is 0.
+const defaultMaxIdleConns = 2
+
+// ConfigurePool applies the connection pool settings of dbConf to the underlying sql.DB, and the one of the replicas.
+// It can be called while the DB is in use.
+func (d DB) ConfigurePool(dbConf config.DatabaseConfig) error {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return errors.NewUnknownf("failed to get the sql.DB, error: %w", err)
+	}
+	configurePool(sqlDB, dbConf)
+	for _, replica := range d.replicas.list() {
+		if sqlDB, err = replica.db.DB(); err != nil {
+			return errors.NewUnknownf("failed to get the sql.DB of replica: %s, error: %w", replica.host, err)
+		}
+		configurePool(sqlDB, dbConf)
+	}
+	return nil
+}
+
+func configurePool(sqlDB *sql.DB, dbConf config.DatabaseConfig) {
+	maxIdleConns := dbConf.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = defaultMaxIdleConns
 	}
+	sqlDB.SetMaxOpenConns(dbConf.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(maxIdleConns)
+	sqlDB.SetConnMaxLifetime(dbConf.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(dbConf.ConnMaxIdleTime)
+}
+
+// SubscribeToConfigChanges applies the rotation of the database user and password, which happens when their secrets
+// change, to the new connections, and the changes of the connection pool and transaction retry settings. Any other
+// change of the database config requires a restart. It does nothing if no config.Watcher is provided.
+func SubscribeToConfigChanges(deps struct {
+	fx.In
+
+	DB      DB
+	Watcher *config.Watcher `optional:"true"`
+	LF      *log.LoggerFactory
+}) {
+	if deps.Watcher == nil {
+		return
+	}
+	logger := deps.LF.GetLoggerForType(deps.DB)
+	deps.Watcher.Subscribe(func(oldConf, newConf config.Config) {
+		oldDBConf, newDBConf := oldConf.Database, newConf.Database
+		if reflect.DeepEqual(oldDBConf, newDBConf) {
+			return
+		}
+		if oldDBConf.Host != newDBConf.Host ||
+			oldDBConf.Port != newDBConf.Port ||
+			oldDBConf.DBName != newDBConf.DBName ||
+			oldDBConf.ApplicationName != newDBConf.ApplicationName ||
+			oldDBConf.SSLMode != newDBConf.SSLMode ||
+			oldDBConf.SSLRootCert != newDBConf.SSLRootCert ||
+			oldDBConf.ConnectTimeout != newDBConf.ConnectTimeout ||
+			oldDBConf.StatementTimeout != newDBConf.StatementTimeout ||
+			!reflect.DeepEqual(oldDBConf.Replicas, newDBConf.Replicas) {
+			logger.Warnf("DB connection settings changed, a restart is required to apply them")
+		}
+		if oldDBConf.User != newDBConf.User || oldDBConf.Pass != newDBConf.Pass {
+			logger.Infof("DB credentials changed, using them for new connections")
+			deps.DB.UpdateCredentials(newDBConf)
+		}
+		if oldDBConf.TxMaxRetries != newDBConf.TxMaxRetries ||
+			oldDBConf.TxRetryBackoff != newDBConf.TxRetryBackoff ||
+			oldDBConf.TxRetryMaxBackoff != newDBConf.TxRetryMaxBackoff {
+			logger.Infof("DB transaction retry settings changed, applying them")
+			if deps.DB.conf != nil {
+				deps.DB.conf.Store(&newDBConf)
+			}
+		}
+		if oldDBConf.MaxOpenConns != newDBConf.MaxOpenConns ||
+			oldDBConf.MaxIdleConns != newDBConf.MaxIdleConns ||
+			oldDBConf.ConnMaxLifetime != newDBConf.ConnMaxLifetime ||
+			oldDBConf.ConnMaxIdleTime != newDBConf.ConnMaxIdleTime {
+			logger.Infof("DB connection pool settings changed, applying them")
+			if err := deps.DB.ConfigurePool(newDBConf); err != nil {
+				logger.ErrorE(err)
+			}
+		}
+	})
 }
 
 func (d DB) SetCtx(ctx context.Context) context.Context {
@@ -63,10 +182,34 @@ func (d DB) SetCtx(ctx context.Context) context.Context {
 		return ctx
 	}
 
-	return context.CtxSetValue(ctx, DBCtxKey, d.WithContext(ctx))
+	ctx = context.CtxSetValue(ctx, DBCtxKey, d.WithContext(ctx))
+	if d.replicas != nil {
+		ctx = context.CtxSetValue(ctx, DBReplicasCtxKey, d.replicas)
+	}
+	if d.conf != nil {
+		ctx = context.CtxSetValue(ctx, dbConfCtxKey, d.conf)
+	}
+	return ctx
 }
 
+// GetDBFromCtx returns the DB of the context. If the context is marked with ReadOnly, and there is no open transaction,
+// it returns a healthy replica, or the primary if there are none.
 func GetDBFromCtx(ctx context.Context) *gorm.DB {
+	db := getPrimaryDBFromCtx(ctx)
+	if db == nil || !IsReadOnly(ctx) {
+		return db
+	}
+	// Open transactions stay on the primary
+	if tx := GetDBTxFromCtx(ctx); tx != nil && !tx.closed {
+		return db
+	}
+	if replica := getReplicaDBFromCtx(ctx); replica != nil {
+		return replica
+	}
+	return db
+}
+
+func getPrimaryDBFromCtx(ctx context.Context) *gorm.DB {
 	// DB context is set in the middleware, and can also be set manually in tests, worker contexts, etc...
 	if db, is := ctx.Value(DBCtxKey).(*gorm.DB); is {
 		// Update DB context, it could have change if a no deadline context was passed
@@ -86,6 +229,9 @@ type DBTx struct {
 	automatic bool
 	parentTx  *DBTx
 	savePoint string
+	// afterCommit and afterRollback are the hooks registered with AfterCommit and AfterRollback
+	afterCommit   []TxHook
+	afterRollback []TxHook
 }
 
 func (t *DBTx) IsAutomatic() bool {
@@ -136,6 +282,22 @@ Killing the process, because it will leak memory otherwise
 	}
 }
 func (t *DBTx) Commit() *gorm.DB {
+	ctx, afterCommit, afterRollback := t.takeHooks()
+	result := t.commit()
+	switch {
+	case result.Error != nil:
+		runTxHooks(ctx, afterRollback)
+	case t.parentTx != nil:
+		// The changes of a sub tx are committed with the parent
+		t.parentTx.afterCommit = append(t.parentTx.afterCommit, afterCommit...)
+		t.parentTx.afterRollback = append(t.parentTx.afterRollback, afterRollback...)
+	default:
+		runTxHooks(ctx, afterCommit)
+	}
+	return result
+}
+
+func (t *DBTx) commit() *gorm.DB {
 	defer func() {
 		t.closed = true
 		// Avoid future use of this subTx
@@ -149,6 +311,13 @@ func (t *DBTx) Commit() *gorm.DB {
 }
 
 func (t *DBTx) Rollback() *gorm.DB {
+	ctx, _, afterRollback := t.takeHooks()
+	result := t.rollback()
+	runTxHooks(ctx, afterRollback)
+	return result
+}
+
+func (t *DBTx) rollback() *gorm.DB {
 	defer func() {
 		t.closed = true
 		// Avoid future use of this subTx
@@ -198,27 +367,55 @@ func WithTx(ctx context.Context, txOptions ...*sql.TxOptions) (*DBTx, context.Co
 		if err != nil {
 			panic(errors.NewUnknownf("failed to create a save point in the db transaction: %w", err))
 		}
-		return &DBTx{
+		subTx := &DBTx{
 			DB:        tx.DB,
 			closed:    false,
 			automatic: false,
 			parentTx:  tx,
 			savePoint: savePoint,
-		}, ctx
+		}
+		if err = applyTxSettings(ctx, subTx.DB); err != nil {
+			subTx.AddError(err)
+		}
+		return subTx, ctx
 	}
 
-	db := GetDBFromCtx(ctx)
+	db := getPrimaryDBFromCtx(ctx)
 	if db == nil {
 		panic(errors.Newf(errors.ErrCodeBadState, "no db in context!"))
 	}
+	// Read-only transactions go to a replica, if there is a healthy one
+	if len(txOptions) > 0 && txOptions[0] != nil && txOptions[0].ReadOnly {
+		if replica := getReplicaDBFromCtx(ctx); replica != nil {
+			db = replica
+		}
+	}
 
 	tx = &DBTx{DB: db.Begin(txOptions...)}
+	if tx.Error == nil {
+		if err := applyTxSettings(ctx, tx.DB); err != nil {
+			tx.AddError(err)
+		}
+	}
 	ctx = context.CtxSetValue(ctx, DBTxCtxKey, tx)
 
 	return tx, ctx
 }
 
 func MustOpenGORM(conf config.Config, dbName string, lf *log.LoggerFactory) *gorm.DB {
+	credentials := &atomic.Pointer[config.DatabaseConfig]{}
+	credentials.Store(&conf.Database)
+	return mustOpenGORM(conf, dbName, credentials, lf, false)
+}
+
+// mustOpenGORM opens the DB of conf.Database. Unless lazy, it connects to it, and panics if it fails.
+func mustOpenGORM(
+	conf config.Config,
+	dbName string,
+	credentials *atomic.Pointer[config.DatabaseConfig],
+	lf *log.LoggerFactory,
+	lazy bool,
+) *gorm.DB {
 	dbConf := conf.Database
 	dsn := fmt.Sprintf("host='%s' user='%s' password='%s' dbname='%s' port=%d",
 		dbConf.Host,
@@ -226,32 +423,80 @@ func MustOpenGORM(conf config.Config, dbName string, lf *log.LoggerFactory) *gor
 		dbConf.Pass,
 		dbName,
 		dbConf.Port)
+	if dbConf.SSLMode != "" {
+		dsn += fmt.Sprintf(" sslmode='%s'", dbConf.SSLMode)
+	}
+	if dbConf.SSLRootCert != "" {
+		dsn += fmt.Sprintf(" sslrootcert='%s'", dbConf.SSLRootCert)
+	}
 	gormConf := gorm.Config{
 		Logger: NewGormLogger(lf.GetLoggerForType(gorm.DB{})),
 		NowFunc: func() time.Time {
 			// Return time with microsecond precision. Postgres timestamp type has microsecond precision.
 			return time.UnixMicro(time.Now().UnixMicro())
 		},
+		DisableAutomaticPing: lazy,
 	}
 
-	var db *gorm.DB
-	var err error
+	pgxConf, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		dsn = strings.ReplaceAll(dsn, "'"+dbConf.Pass+"'", "*")
+		panic(errors.NewUnknownf("invalid DB config: %s, error: %w", dsn, err))
+	}
+	if dbConf.ConnectTimeout > 0 {
+		pgxConf.ConnectTimeout = dbConf.ConnectTimeout
+	}
+	applicationName := dbConf.ApplicationName
+	if applicationName == "" {
+		applicationName = conf.Name
+	}
+	if applicationName != "" {
+		pgxConf.RuntimeParams["application_name"] = applicationName
+	}
+	if dbConf.StatementTimeout > 0 {
+		pgxConf.RuntimeParams["statement_timeout"] = strconv.FormatInt(dbConf.StatementTimeout.Milliseconds(), 10)
+	}
+	connector := stdlib.GetConnector(*pgxConf, stdlib.OptionBeforeConnect(
+		func(_ stdcontext.Context, connConf *pgx.ConnConfig) error {
+			current := credentials.Load()
+			connConf.User = current.User
+			connConf.Password = current.Pass
+			return nil
+		},
+	))
 
+	var db *gorm.DB
+	var sqlDB *sql.DB
 	if conf.Datadog.Tracing {
 		sqltrace.Register("pgx", &stdlib.Driver{})
-		db, err = gormtrace.Open(postgres.Open(dsn), &gormConf)
+		sqlDB = sqltrace.OpenDB(connector)
+		configurePool(sqlDB, dbConf)
+		db, err = gormtrace.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gormConf)
 	} else {
-		db, err = gorm.Open(postgres.Open(dsn), &gormConf)
+		sqlDB = sql.OpenDB(connector)
+		configurePool(sqlDB, dbConf)
+		db, err = gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gormConf)
 	}
 	if err != nil {
 		dsn = strings.ReplaceAll(dsn, "'"+dbConf.Pass+"'", "*")
 		panic(errors.NewUnknownf("could not connect to DB: %s, error: %w", dsn, err))
 	}
-	lf.GetLogger().Infof("DB connection established: \"%s\"", dbName)
+	if err = db.Use(errorTranslator{}); err != nil {
+		panic(errors.NewUnknownf("failed to register the error translator, error: %w", err))
+	}
+	if err = db.Use(txSettingsApplier{}); err != nil {
+		panic(errors.NewUnknownf("failed to register the transaction settings, error: %w", err))
+	}
+	if !lazy {
+		lf.GetLogger().Infof("DB connection established: \"%s\"", dbName)
+	}
 	return db
 }
 
 func OnDBStop(db DB) error {
+	if err := db.replicas.close(); err != nil {
+		return err
+	}
 	sqlDB, err := db.DB.DB()
 	if err != nil {
 		return err
@@ -259,4 +504,7 @@ func OnDBStop(db DB) error {
 	return sqlDB.Close()
 }
 
-var Module = fx.Provide(fx.Annotate(NewDB, fx.OnStop(OnDBStop)))
+var Module = fx.Options(
+	fx.Provide(fx.Annotate(NewDB, fx.OnStop(OnDBStop))),
+	fx.Invoke(SubscribeToConfigChanges),
+)
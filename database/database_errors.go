@@ -0,0 +1,111 @@
+package database
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+const (
+	// PgCodeNotNullViolation is the SQLSTATE of a NULL value in a NOT NULL column.
+	PgCodeNotNullViolation = "23502"
+	// PgCodeForeignKeyViolation is the SQLSTATE of a row referencing a missing row, or referenced by another row.
+	PgCodeForeignKeyViolation = "23503"
+	// PgCodeUniqueViolation is the SQLSTATE of a duplicate value in a unique index.
+	PgCodeUniqueViolation = "23505"
+	// PgCodeCheckViolation is the SQLSTATE of a row that doesn't satisfy a check constraint.
+	PgCodeCheckViolation = "23514"
+	// PgCodeInvalidTextRepresentation is the SQLSTATE of a value that can't be parsed, like an invalid UUID.
+	PgCodeInvalidTextRepresentation = "22P02"
+	// PgCodeQueryCanceled is the SQLSTATE of a statement canceled by the statement_timeout, or by the client.
+	PgCodeQueryCanceled = "57014"
+)
+
+// pgCodesToErrCodes are the Postgres errors translated by TranslateError, with the code and description they get.
+var pgCodesToErrCodes = map[string]struct {
+	code        string
+	description string
+}{
+	PgCodeUniqueViolation:           {errors.ErrCodeConflict, "unique violation"},
+	PgCodeForeignKeyViolation:       {errors.ErrCodeBadArgument, "foreign key violation"},
+	PgCodeNotNullViolation:          {errors.ErrCodeBadArgument, "not null violation"},
+	PgCodeCheckViolation:            {errors.ErrCodeBadArgument, "check violation"},
+	PgCodeInvalidTextRepresentation: {errors.ErrCodeBadArgument, "invalid value"},
+	PgCodeQueryCanceled:             {errors.ErrCodeTimeout, "query canceled"},
+}
+
+/*
+TranslateError translates the Postgres errors caused by the data, and gorm.ErrRecordNotFound, to an errors.Error with
+the matching code, so the rest.ErrorHandlerMiddleware responds with the right HTTP status:
+  - unique violation: errors.ErrCodeConflict
+  - foreign key, not null and check violations, and invalid values: errors.ErrCodeBadArgument
+  - query canceled, like by the statement timeout: errors.ErrCodeTimeout
+  - gorm.ErrRecordNotFound: errors.ErrCodeNotFound
+
+The message has the table, column and constraint of the error, when Postgres reports them. The original error is
+wrapped, so errors.Is and errors.As still find it, like the *pgconn.PgError with all the details. Other errors, and the
+ones that already are an errors.Error, are returned as they are.
+
+The DB returned by NewDB translates the errors of all the statements, so this is only needed for errors from elsewhere.
+*/
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var fwErr *errors.Error
+	if errors.As(err, &fwErr) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.Newf(errors.ErrCodeNotFound, "%w", err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	translation, found := pgCodesToErrCodes[pgErr.Code]
+	if !found {
+		return err
+	}
+	message := translation.description
+	if pgErr.TableName != "" {
+		message += ", table: " + pgErr.TableName
+	}
+	if pgErr.ColumnName != "" {
+		message += ", column: " + pgErr.ColumnName
+	}
+	if pgErr.ConstraintName != "" {
+		message += ", constraint: " + pgErr.ConstraintName
+	}
+	return errors.Newf(translation.code, "%s, error: %w", message, err)
+}
+
+// errorTranslator is a gorm.Plugin that translates the errors of all the statements with TranslateError.
+type errorTranslator struct{}
+
+var _ gorm.Plugin = errorTranslator{}
+
+func (errorTranslator) Name() string {
+	return "fw:error_translator"
+}
+
+func (errorTranslator) Initialize(db *gorm.DB) error {
+	translate := func(db *gorm.DB) {
+		db.Error = TranslateError(db.Error)
+	}
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("*").Register("fw:translate_error", translate),
+		callbacks.Query().After("*").Register("fw:translate_error", translate),
+		callbacks.Update().After("*").Register("fw:translate_error", translate),
+		callbacks.Delete().After("*").Register("fw:translate_error", translate),
+		callbacks.Row().After("*").Register("fw:translate_error", translate),
+		callbacks.Raw().After("*").Register("fw:translate_error", translate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
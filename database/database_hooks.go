@@ -0,0 +1,75 @@
+package database
+
+import (
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// TxHook is run after a transaction ends, with its context. The transaction is closed by then, so InTx and WithTx use
+// a new one, or the parent one for the hooks of a rolled back sub transaction.
+type TxHook func(ctx context.Context)
+
+/*
+AfterCommit registers a hook that runs once the outermost transaction commits, for side effects that must only happen
+if the changes are persisted, like publishing a message or evicting a cache entry.
+
+The hooks of a sub transaction are passed to its parent when the savepoint is released, and dropped when it is rolled
+back. In an automatic transaction, see InTx, every query commits on its own, so the hook runs right away. A panic in a
+hook is logged, and the other hooks still run.
+*/
+func (t *DBTx) AfterCommit(hook TxHook) {
+	if t.automatic {
+		runTxHooks(t.hookCtx(), []TxHook{hook})
+		return
+	}
+	t.checkOpen()
+	t.afterCommit = append(t.afterCommit, hook)
+}
+
+// AfterRollback registers a hook that runs once the transaction is rolled back, or fails to commit. The hooks of a sub
+// transaction run when its savepoint is rolled back, and are passed to its parent when the savepoint is released. In an
+// automatic transaction, see InTx, the hook never runs.
+func (t *DBTx) AfterRollback(hook TxHook) {
+	if t.automatic {
+		return
+	}
+	t.checkOpen()
+	t.afterRollback = append(t.afterRollback, hook)
+}
+
+func (t *DBTx) checkOpen() {
+	if t.closed {
+		panic(errors.Newf(errors.ErrCodeBadState, "transaction is closed, the hook would never run"))
+	}
+}
+
+// takeHooks returns the context of the transaction and its hooks, which are removed from it.
+func (t *DBTx) takeHooks() (context.Context, []TxHook, []TxHook) {
+	ctx := t.hookCtx()
+	afterCommit, afterRollback := t.afterCommit, t.afterRollback
+	t.afterCommit, t.afterRollback = nil, nil
+	return ctx, afterCommit, afterRollback
+}
+
+func (t *DBTx) hookCtx() context.Context {
+	if t.DB != nil && t.Statement != nil && t.Statement.Context != nil {
+		return t.Statement.Context
+	}
+	return context.Background()
+}
+
+func runTxHooks(ctx context.Context, hooks []TxHook) {
+	for _, hook := range hooks {
+		runTxHook(ctx, hook)
+	}
+}
+
+func runTxHook(ctx context.Context, hook TxHook) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.GetLoggerFromCtx(ctx).ErrorE(errors.Newf(errors.ErrCodePanic, "panic in transaction hook: %v", r))
+		}
+	}()
+	hook(ctx)
+}
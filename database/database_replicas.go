@@ -0,0 +1,267 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+var readOnlyCtxKey = context.CtxKey("_fw_db_read_only")
+
+// replicaCheckTimeout is the timeout of the check of every replica.
+const replicaCheckTimeout = 5 * time.Second
+
+// replicaLagSQL returns the replication lag in seconds. It is 0 when the replica replayed everything it received, which
+// avoids reporting the time since the last write as lag when the primary is idle.
+const replicaLagSQL = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// ReadOnly marks the context so GetDBFromCtx, and so InTx, return a replica while there is no open transaction. Use
+// WithTx with sql.TxOptions{ReadOnly: true} for a read-only transaction in a replica.
+func ReadOnly(ctx context.Context) context.Context {
+	return context.CtxSetValue(ctx, readOnlyCtxKey, true)
+}
+
+// IsReadOnly returns whether the context was marked with ReadOnly.
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyCtxKey).(bool)
+	return readOnly
+}
+
+func getReplicaDBFromCtx(ctx context.Context) *gorm.DB {
+	replicas, is := ctx.Value(DBReplicasCtxKey).(*Replicas)
+	if !is {
+		return nil
+	}
+	if db := replicas.Next(); db != nil {
+		return db.WithContext(ctx)
+	}
+	return nil
+}
+
+// ReplicaStatus is the result of the last check of a replica.
+type ReplicaStatus struct {
+	Host    string
+	Healthy bool
+	Lag     time.Duration
+	Err     error
+}
+
+func (s ReplicaStatus) String() string {
+	if s.Err != nil {
+		return fmt.Sprintf("%s: %s", s.Host, s.Err)
+	}
+	return fmt.Sprintf("%s: lag: %s", s.Host, s.Lag)
+}
+
+type replica struct {
+	host   string
+	db     *gorm.DB
+	status atomic.Pointer[ReplicaStatus]
+}
+
+/*
+Replicas are the read replicas of a DB. They are checked every config.DatabaseConfig.ReplicaCheckInterval, and the ones
+that fail, or lag more than config.DatabaseConfig.ReplicaMaxLag, are removed from rotation until they recover.
+*/
+type Replicas struct {
+	replicas      []*replica
+	next          atomic.Uint32
+	maxLag        time.Duration
+	checkInterval time.Duration
+	logger        log.Logger
+
+	mu      sync.Mutex
+	stopChn chan struct{}
+	doneChn chan struct{}
+}
+
+// newReplicas opens the replicas of conf.Database, checks them, and starts checking them in the background. It returns
+// nil if there are none.
+func newReplicas(
+	conf config.Config,
+	dbName string,
+	credentials *atomic.Pointer[config.DatabaseConfig],
+	lf *log.LoggerFactory,
+) *Replicas {
+	if len(conf.Database.Replicas) == 0 {
+		return nil
+	}
+	r := &Replicas{
+		maxLag:        conf.Database.ReplicaMaxLag,
+		checkInterval: conf.Database.ReplicaCheckInterval,
+		logger:        lf.GetLoggerForType(Replicas{}),
+	}
+	for _, replicaConf := range conf.Database.Replicas {
+		dbConf := conf.Database
+		dbConf.Host = replicaConf.Host
+		if replicaConf.Port != 0 {
+			dbConf.Port = replicaConf.Port
+		}
+		replicaAppConf := conf
+		replicaAppConf.Database = dbConf
+		// Replicas connect lazily, so an unavailable one doesn't prevent the app from starting
+		r.replicas = append(r.replicas, &replica{
+			host: fmt.Sprintf("%s:%d", dbConf.Host, dbConf.Port),
+			db:   mustOpenGORM(replicaAppConf, dbName, credentials, lf, true),
+		})
+	}
+	r.Check(context.Background())
+	r.start()
+	return r
+}
+
+func (r *Replicas) list() []*replica {
+	if r == nil {
+		return nil
+	}
+	return r.replicas
+}
+
+// Next returns the next healthy replica, in round-robin order, or nil if there are none.
+func (r *Replicas) Next() *gorm.DB {
+	if r == nil {
+		return nil
+	}
+	start := r.next.Add(1)
+	for i := range uint32(len(r.replicas)) {
+		replica := r.replicas[(start+i)%uint32(len(r.replicas))]
+		if status := replica.status.Load(); status != nil && status.Healthy {
+			return replica.db
+		}
+	}
+	return nil
+}
+
+// Status returns the result of the last check of every replica.
+func (r *Replicas) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(r.list()))
+	for _, replica := range r.list() {
+		if status := replica.status.Load(); status != nil {
+			statuses = append(statuses, *status)
+		}
+	}
+	return statuses
+}
+
+// Check checks the health and the replication lag of every replica, adding or removing them from rotation.
+func (r *Replicas) Check(ctx context.Context) {
+	for _, replica := range r.list() {
+		status := &ReplicaStatus{Host: replica.host}
+		var lagSeconds float64
+		checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		err := replica.db.WithContext(checkCtx).Raw(replicaLagSQL).Scan(&lagSeconds).Error
+		cancel()
+		if err != nil {
+			status.Err = err
+		} else {
+			status.Lag = time.Duration(lagSeconds * float64(time.Second))
+			if r.maxLag > 0 && status.Lag > r.maxLag {
+				status.Err = errors.Newf(
+					errors.ErrCodeBadState,
+					"replication lag: %s is greater than: %s",
+					status.Lag,
+					r.maxLag,
+				)
+			}
+		}
+		status.Healthy = status.Err == nil
+
+		previous := replica.status.Swap(status)
+		switch {
+		case !status.Healthy && (previous == nil || previous.Healthy):
+			r.logger.Warnf("DB replica removed from rotation: %s", status)
+		case status.Healthy && previous != nil && !previous.Healthy:
+			r.logger.Infof("DB replica back in rotation: %s", status)
+		}
+	}
+}
+
+// HealthCheck fails if no replica is healthy, so the reads are served by the primary.
+func (r *Replicas) HealthCheck() error {
+	statuses := r.Status()
+	var failed []string
+	for _, status := range statuses {
+		if status.Healthy {
+			return nil
+		}
+		failed = append(failed, status.String())
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.Newf(errors.ErrCodeBadState, "no healthy DB replicas: %s", strings.Join(failed, ", "))
+}
+
+func (r *Replicas) start() {
+	if r.checkInterval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopChn = make(chan struct{})
+	r.doneChn = make(chan struct{})
+	go func(stopChn, doneChn chan struct{}) {
+		defer close(doneChn)
+		ticker := time.NewTicker(r.checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChn:
+				return
+			case <-ticker.C:
+				r.Check(context.Background())
+			}
+		}
+	}(r.stopChn, r.doneChn)
+}
+
+// close stops the background checks and closes the replicas.
+func (r *Replicas) close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	stopChn, doneChn := r.stopChn, r.doneChn
+	r.stopChn, r.doneChn = nil, nil
+	r.mu.Unlock()
+	if stopChn != nil {
+		close(stopChn)
+		<-doneChn
+	}
+	for _, replica := range r.replicas {
+		sqlDB, err := replica.db.DB()
+		if err != nil {
+			return err
+		}
+		if err = sqlDB.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replicas returns the read replicas, or nil if there are none.
+func (d DB) Replicas() *Replicas {
+	return d.replicas
+}
+
+// Replica returns a healthy replica, or the primary if there are none.
+func (d DB) Replica() *gorm.DB {
+	if db := d.replicas.Next(); db != nil {
+		return db
+	}
+	return d.DB
+}
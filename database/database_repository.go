@@ -0,0 +1,326 @@
+package database
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// The columns of a model that the Repository fills.
+const (
+	VersionColumn   = "version"
+	CreatedByColumn = "created_by"
+	UpdatedByColumn = "updated_by"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// versionColumn is qualified with the table, as the upserts also have the excluded one.
+var versionColumn = clause.Column{Table: clause.CurrentTable, Name: VersionColumn}
+
+/*
+Repository has the common operations of a model T, in the transaction of the context, see InTx. It fills these columns
+of the model, when it has them:
+  - version: an integer, for optimistic locking. It starts at 1, and every Update increments it. Update and Delete
+    fail with errors.ErrCodeConflict if the row has another version, as it was written after it was read.
+  - created_by and updated_by: the ID of the middleware.Principal of the request, when there is one.
+  - deleted_at: a gorm.DeletedAt, for soft delete. Delete sets it, Restore clears it, and the other operations skip the
+    deleted rows.
+
+The errors keep the codes given by TranslateError, like errors.ErrCodeNotFound for a missing row, or
+errors.ErrCodeConflict for a duplicate key.
+*/
+type Repository[T any] struct{}
+
+func NewRepository[T any]() Repository[T] {
+	return Repository[T]{}
+}
+
+// Get returns the row with the primary key id.
+func (r Repository[T]) Get(ctx context.Context, id any) (*T, error) {
+	entity := new(T)
+	err := InTx(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).First(entity).Error
+	if err != nil {
+		return nil, wrapError(err, "failed to get %T: %v", entity, id)
+	}
+	return entity, nil
+}
+
+// List returns the rows selected by the scopes, which can also order and limit them, or all of them if there are none.
+func (r Repository[T]) List(ctx context.Context, scopes ...func(*gorm.DB) *gorm.DB) ([]T, error) {
+	var entities []T
+	if err := InTx(ctx).Scopes(scopes...).Find(&entities).Error; err != nil {
+		return nil, wrapError(err, "failed to list %T", entities)
+	}
+	return entities, nil
+}
+
+// Create inserts the entity, with version 1.
+func (r Repository[T]) Create(ctx context.Context, entity *T) error {
+	db := InTx(ctx).DB
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(entity).Elem()
+	if err = setPrincipal(ctx, sch, value, CreatedByColumn, UpdatedByColumn); err != nil {
+		return err
+	}
+	if version := sch.LookUpField(VersionColumn); version != nil {
+		if _, isZero := version.ValueOf(ctx, value); isZero {
+			if err = version.Set(ctx, value, 1); err != nil {
+				return errors.NewUnknownf("failed to set the version of %T, error: %w", entity, err)
+			}
+		}
+	}
+	if err = db.Create(entity).Error; err != nil {
+		return wrapError(err, "failed to create %T", entity)
+	}
+	return nil
+}
+
+// Update writes all the fields of the entity, but the creation ones, and increments its version. It fails with
+// errors.ErrCodeConflict if the row has another version.
+func (r Repository[T]) Update(ctx context.Context, entity *T) error {
+	db := InTx(ctx).DB
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(entity).Elem()
+	if err = setPrincipal(ctx, sch, value, UpdatedByColumn); err != nil {
+		return err
+	}
+	omit := []string{CreatedByColumn}
+	for _, field := range sch.Fields {
+		if field.AutoCreateTime > 0 || field.FieldType == deletedAtType {
+			omit = append(omit, field.DBName)
+		}
+	}
+	query := db.Model(entity).Select("*").Omit(omit...)
+	version, err := versionOf(ctx, sch, value)
+	if err != nil {
+		return err
+	}
+	if version.IsValid() {
+		current := version.Int()
+		query = query.Where(clause.Eq{Column: versionColumn, Value: current})
+		version.SetInt(current + 1)
+		defer func() {
+			if err != nil {
+				version.SetInt(current)
+			}
+		}()
+	}
+	result := query.Updates(entity)
+	if err = result.Error; err != nil {
+		return wrapError(err, "failed to update %T", entity)
+	}
+	if result.RowsAffected == 0 {
+		err = notFoundOrConflict[T](ctx, sch, value)
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the entity, softly if it has a deleted_at column. It fails with errors.ErrCodeConflict if the row has
+// another version.
+func (r Repository[T]) Delete(ctx context.Context, entity *T) error {
+	db := InTx(ctx).DB
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(entity).Elem()
+	version, err := versionOf(ctx, sch, value)
+	if err != nil {
+		return err
+	}
+	query := db
+	if version.IsValid() {
+		query = query.Where(clause.Eq{Column: versionColumn, Value: version.Int()})
+	}
+	result := query.Delete(entity)
+	if result.Error != nil {
+		return wrapError(result.Error, "failed to delete %T", entity)
+	}
+	if result.RowsAffected == 0 {
+		return notFoundOrConflict[T](ctx, sch, value)
+	}
+	return nil
+}
+
+// Restore undeletes the soft deleted row with the primary key id, and increments its version. It fails with
+// errors.ErrCodeNotFound if there is no such deleted row.
+func (r Repository[T]) Restore(ctx context.Context, id any) error {
+	db := InTx(ctx).DB
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	var deletedAt *schema.Field
+	for _, field := range sch.Fields {
+		if field.FieldType == deletedAtType {
+			deletedAt = field
+		}
+	}
+	if deletedAt == nil {
+		return errors.Newf(errors.ErrCodeBadState, "%s has no soft delete column", sch.Name)
+	}
+
+	updates := map[string]any{deletedAt.DBName: nil}
+	if sch.LookUpField(VersionColumn) != nil {
+		updates[VersionColumn] = gorm.Expr("? + 1", versionColumn)
+	}
+	if sch.LookUpField(UpdatedByColumn) != nil {
+		if principalID, found := getPrincipalID(ctx); found {
+			updates[UpdatedByColumn] = principalID
+		}
+	}
+	result := db.Unscoped().
+		Model(new(T)).
+		Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).
+		Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: deletedAt.DBName}, Value: nil}).
+		Updates(updates)
+	if result.Error != nil {
+		return wrapError(result.Error, "failed to restore %s: %v", sch.Name, id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Newf(errors.ErrCodeNotFound, "deleted %s: %v not found", sch.Name, id)
+	}
+	return nil
+}
+
+/*
+Upsert inserts the entity, or updates the row with its primary key if there is one, and then loads the row into the
+entity. The update writes all the fields, but the creation ones, and increments the version without checking it, so the
+last write wins. It also restores the row if it was soft deleted.
+*/
+func (r Repository[T]) Upsert(ctx context.Context, entity *T) error {
+	db := InTx(ctx).DB
+	sch, err := parseSchema[T](db)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(entity).Elem()
+	if err = setPrincipal(ctx, sch, value, CreatedByColumn, UpdatedByColumn); err != nil {
+		return err
+	}
+
+	onConflict := clause.OnConflict{}
+	var updateColumns []string
+	for _, field := range sch.Fields {
+		switch {
+		case field.DBName == "":
+		case field.PrimaryKey:
+			onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+		case field.AutoCreateTime > 0, field.DBName == CreatedByColumn, field.DBName == VersionColumn:
+		default:
+			updateColumns = append(updateColumns, field.DBName)
+		}
+	}
+	onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	if version := sch.LookUpField(VersionColumn); version != nil {
+		if _, isZero := version.ValueOf(ctx, value); isZero {
+			if err = version.Set(ctx, value, 1); err != nil {
+				return errors.NewUnknownf("failed to set the version of %T, error: %w", entity, err)
+			}
+		}
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: VersionColumn},
+			Value:  gorm.Expr("? + 1", versionColumn),
+		})
+	}
+	if err = db.Clauses(onConflict, clause.Returning{}).Create(entity).Error; err != nil {
+		return wrapError(err, "failed to upsert %T", entity)
+	}
+	return nil
+}
+
+func parseSchema[T any](db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, errors.NewUnknownf("failed to parse the model: %T, error: %w", *new(T), err)
+	}
+	return stmt.Schema, nil
+}
+
+// versionOf returns the version field of the entity, or an invalid reflect.Value if the model has none.
+func versionOf(ctx context.Context, sch *schema.Schema, value reflect.Value) (reflect.Value, error) {
+	field := sch.LookUpField(VersionColumn)
+	if field == nil {
+		return reflect.Value{}, nil
+	}
+	version := field.ReflectValueOf(ctx, value)
+	if !version.CanInt() {
+		return reflect.Value{}, errors.Newf(
+			errors.ErrCodeBadState,
+			"the version of %s must be an integer, not: %s",
+			sch.Name,
+			version.Type(),
+		)
+	}
+	return version, nil
+}
+
+// notFoundOrConflict returns the error of a write that matched no row: errors.ErrCodeConflict if the row exists, so it
+// has another version, or errors.ErrCodeNotFound.
+func notFoundOrConflict[T any](ctx context.Context, sch *schema.Schema, value reflect.Value) error {
+	if sch.LookUpField(VersionColumn) != nil {
+		// The model, instead of the table, skips the soft deleted rows
+		query := InTx(ctx).Model(new(T))
+		for _, field := range sch.PrimaryFields {
+			id, _ := field.ValueOf(ctx, value)
+			column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+			query = query.Where(clause.Eq{Column: column, Value: id})
+		}
+		// Count, unlike Scan, runs in a transaction with the settings of the context, see SetTxSetting
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return wrapError(err, "failed to check if %s exists", sch.Name)
+		}
+		if count > 0 {
+			return errors.Newf(errors.ErrCodeConflict, "%s was modified after it was read, reload it", sch.Name)
+		}
+	}
+	return errors.Newf(errors.ErrCodeNotFound, "%s not found", sch.Name)
+}
+
+// setPrincipal sets the ID of the principal of the request in the columns of the entity, when the model has them.
+func setPrincipal(ctx context.Context, sch *schema.Schema, value reflect.Value, columns ...string) error {
+	principalID, found := getPrincipalID(ctx)
+	if !found {
+		return nil
+	}
+	for _, column := range columns {
+		if field := sch.LookUpField(column); field != nil {
+			if err := field.Set(ctx, value, principalID); err != nil {
+				return errors.NewUnknownf("failed to set the %s of %s, error: %w", column, sch.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func getPrincipalID(ctx context.Context) (any, bool) {
+	principal, is := ctx.Value(context.PrincipalCtxKey).(interface{ GetID() any })
+	if !is || principal == nil {
+		return nil, false
+	}
+	return principal.GetID(), true
+}
+
+// wrapError adds the message to the error, keeping its code, so the REST response keeps the status.
+func wrapError(err error, format string, args ...any) error {
+	code := errors.ErrCodeUnknown
+	var fwErr *errors.Error
+	if errors.As(err, &fwErr) {
+		code = fwErr.Code
+	}
+	return errors.Newf(code, format+", error: %w", append(args, err)...)
+}
@@ -0,0 +1,99 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/rest/middleware"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+type account struct {
+	ID        int
+	Name      string `gorm:"uniqueIndex"`
+	Version   int
+	CreatedBy string
+	UpdatedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+type testPrincipal string
+
+func (p testPrincipal) GetID() any                        { return string(p) }
+func (p testPrincipal) GetName() string                   { return string(p) }
+func (p testPrincipal) GetEmail() string                  { return string(p) + "@example.com" }
+func (p testPrincipal) GetType() middleware.PrincipalType { return "user" }
+
+func TestRepository(t *testing.T) {
+	var ctx context.Context
+	test.FxIntegration(t).WithDB().Populate(&ctx)
+	require.NoError(t, database.InTx(ctx).AutoMigrate(&account{}))
+	repo := database.NewRepository[account]()
+	alice := context.CtxSetValue(ctx, middleware.PrincipalCtxKey, testPrincipal("alice"))
+	bob := context.CtxSetValue(ctx, middleware.PrincipalCtxKey, testPrincipal("bob"))
+
+	created := &account{Name: "a"}
+	require.NoError(t, repo.Create(alice, created))
+	require.Equal(t, 1, created.Version)
+	err := repo.Create(alice, &account{Name: "a"})
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+
+	// Optimistic locking
+	loaded, err := repo.Get(ctx, created.ID)
+	require.NoError(t, err)
+	loaded.Name = "b"
+	require.NoError(t, repo.Update(bob, loaded))
+	require.Equal(t, 2, loaded.Version)
+	created.Name = "c"
+	err = repo.Update(bob, created)
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+	require.Equal(t, 1, created.Version)
+	// With transaction settings, and no transaction, the conflict is still found
+	err = repo.Update(database.SetTxSetting(bob, "app.test", "1"), created)
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+	loaded, err = repo.Get(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "b", loaded.Name)
+	require.Equal(t, "alice", loaded.CreatedBy)
+	require.Equal(t, "bob", loaded.UpdatedBy)
+
+	// Soft delete and restore
+	require.True(t, errors.IsCode(repo.Delete(ctx, created), errors.ErrCodeConflict))
+	require.NoError(t, repo.Delete(ctx, loaded))
+	_, err = repo.Get(ctx, created.ID)
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotFound))
+	require.True(t, errors.IsCode(repo.Update(ctx, loaded), errors.ErrCodeNotFound))
+	accounts, err := repo.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, accounts)
+	require.NoError(t, repo.Restore(alice, created.ID))
+	require.True(t, errors.IsCode(repo.Restore(alice, created.ID), errors.ErrCodeNotFound))
+	loaded, err = repo.Get(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, loaded.Version)
+	require.Equal(t, "alice", loaded.UpdatedBy)
+
+	// Upsert inserts, and then updates without checking the version
+	upserted := &account{ID: created.ID + 1, Name: "d"}
+	require.NoError(t, repo.Upsert(bob, upserted))
+	require.Equal(t, 1, upserted.Version)
+	upserted = &account{ID: created.ID + 1, Name: "e"}
+	require.NoError(t, repo.Upsert(alice, upserted))
+	require.Equal(t, 2, upserted.Version)
+	require.Equal(t, "bob", upserted.CreatedBy)
+	require.Equal(t, "alice", upserted.UpdatedBy)
+
+	accounts, err = repo.List(ctx, func(db *gorm.DB) *gorm.DB { return db.Order("name") })
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, "b", accounts[0].Name)
+	require.Equal(t, "e", accounts[1].Name)
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+const ErrCodeTxRetriesExhausted = "DB_TX_RETRIES_EXHAUSTED"
+
+const (
+	// PgCodeSerializationFailure is the SQLSTATE of a transaction that can't be serialized with the concurrent ones.
+	PgCodeSerializationFailure = "40001"
+	// PgCodeDeadlockDetected is the SQLSTATE of a transaction aborted to resolve a deadlock.
+	PgCodeDeadlockDetected = "40P01"
+)
+
+var dbConfCtxKey = context.CtxKey("_fw_db_conf")
+
+// IsRetryableTxError returns whether err is, or wraps, a serialization failure or a deadlock, after which the
+// transaction can be run again.
+func IsRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == PgCodeSerializationFailure || pgErr.Code == PgCodeDeadlockDetected
+}
+
+/*
+RunInTx runs fn in a transaction, with the given options, which is committed if fn returns nil and rolled back
+otherwise. The transaction is in the context passed to fn, use InTx to get it.
+
+If the transaction fails with a serialization failure or a deadlock, see IsRetryableTxError, it is rolled back and fn is
+run again in a new one, after a jittered backoff, up to config.DatabaseConfig.TxMaxRetries times. Then it returns an
+error with the code ErrCodeTxRetriesExhausted. This makes it safe to use the serializable isolation level:
+
+	err := database.RunInTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+		return database.InTx(ctx).Exec("UPDATE account SET balance = balance - 10 WHERE id = ?", id).Error
+	})
+
+Inside another transaction, fn runs in a sub transaction and it is not retried, as the failure aborts the outer one.
+*/
+func RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	// The failure aborts the outer transaction, only its owner can retry it
+	if tx := GetDBTxFromCtx(ctx); tx != nil && !tx.IsClosed() {
+		return runInTx(ctx, opts, fn)
+	}
+
+	dbConf := getDBConfFromCtx(ctx)
+	logger := log.GetLoggerFromCtx(ctx)
+	for attempt := 1; ; attempt++ {
+		err := runInTx(ctx, opts, fn)
+		if err == nil || !IsRetryableTxError(err) {
+			return err
+		}
+		if attempt > dbConf.TxMaxRetries {
+			return errors.Newf(ErrCodeTxRetriesExhausted, "transaction failed after %d attempts: %w", attempt, err)
+		}
+		backoff := txRetryBackoff(dbConf, attempt)
+		logger.Warnf("Transaction attempt: %d failed, retrying in: %s, error: %s", attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return errors.NewUnknownf("transaction retry canceled, error: %w, last error: %w", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func runInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) (err error) {
+	tx, txCtx := WithTx(ctx, opts)
+	defer tx.DeferredCommitOrRollback(&err)
+	return fn(txCtx)
+}
+
+// txRetryBackoff returns the delay before the retry of the attempt: a random duration between half and all of the
+// TxRetryBackoff doubled on every attempt, up to TxRetryMaxBackoff.
+func txRetryBackoff(dbConf config.DatabaseConfig, attempt int) time.Duration {
+	backoff := dbConf.TxRetryBackoff
+	for i := 1; i < attempt && (dbConf.TxRetryMaxBackoff <= 0 || backoff < dbConf.TxRetryMaxBackoff); i++ {
+		backoff *= 2
+	}
+	if dbConf.TxRetryMaxBackoff > 0 && backoff > dbConf.TxRetryMaxBackoff {
+		backoff = dbConf.TxRetryMaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// getDBConfFromCtx returns the config of the DB in the context, or an empty one, without retries, if the DB was not
+// created with OpenDB.
+func getDBConfFromCtx(ctx context.Context) config.DatabaseConfig {
+	if dbConf, is := ctx.Value(dbConfCtxKey).(*atomic.Pointer[config.DatabaseConfig]); is {
+		return *dbConf.Load()
+	}
+	return config.DatabaseConfig{}
+}
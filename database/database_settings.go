@@ -0,0 +1,107 @@
+package database
+
+import (
+	"maps"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+var txSettingsCtxKey = context.CtxKey("_fw_db_tx_settings")
+
+/*
+SetTxSetting returns a context whose transactions set the Postgres run-time parameter, like app.tenant_id, with the
+value, as SET LOCAL does, so it doesn't leak to the other transactions of the connection:
+  - WithTx, and RunInTx, set it at the start of every transaction, and of every savepoint of a nested one.
+  - The statements of InTx outside of a transaction run in one that sets it, but for Row, Rows and Scan, which fail,
+    as their rows are read after the statement.
+*/
+func SetTxSetting(ctx context.Context, name string, value string) context.Context {
+	settings := maps.Clone(GetTxSettings(ctx))
+	if settings == nil {
+		settings = make(map[string]string)
+	}
+	settings[name] = value
+	return context.CtxSetValue(ctx, txSettingsCtxKey, settings)
+}
+
+// GetTxSettings returns the run-time parameters set by the transactions of the context, see SetTxSetting.
+func GetTxSettings(ctx context.Context) map[string]string {
+	settings, _ := ctx.Value(txSettingsCtxKey).(map[string]string)
+	return settings
+}
+
+// applyTxSettings sets the run-time parameters of the context in the transaction of the db.
+func applyTxSettings(ctx context.Context, db *gorm.DB) error {
+	settings := GetTxSettings(ctx)
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		_, err := db.Statement.ConnPool.ExecContext(ctx, "SELECT set_config($1, $2, true)", name, settings[name])
+		if err != nil {
+			return errors.NewUnknownf("failed to set the transaction setting: %s, error: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// txSettingsApplier is a gorm.Plugin that runs the statements outside of a transaction in one with the settings of
+// their context, see SetTxSetting.
+type txSettingsApplier struct{}
+
+var _ gorm.Plugin = txSettingsApplier{}
+
+func (txSettingsApplier) Name() string {
+	return "fw:tx_settings"
+}
+
+func (txSettingsApplier) Initialize(db *gorm.DB) error {
+	// Creates, updates and deletes already run in a transaction, unless gorm.Config.SkipDefaultTransaction is set
+	apply := func(db *gorm.DB) {
+		if db.Error != nil || len(GetTxSettings(db.Statement.Context)) == 0 {
+			return
+		}
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); !inTx {
+			db.AddError(errors.Newf(errors.ErrCodeBadState, "statements with transaction settings need a transaction"))
+		} else if started, _ := db.InstanceGet("gorm:started_transaction"); started == true {
+			db.AddError(applyTxSettings(db.Statement.Context, db))
+		}
+	}
+	begin := func(db *gorm.DB) {
+		if db.Error == nil && len(GetTxSettings(db.Statement.Context)) > 0 {
+			callbacks.BeginTransaction(db)
+			apply(db)
+		}
+	}
+	rejectOutsideTx := func(db *gorm.DB) {
+		if len(GetTxSettings(db.Statement.Context)) == 0 {
+			return
+		}
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); !inTx {
+			db.AddError(errors.Newf(
+				errors.ErrCodeBadState,
+				"Row, Rows and Scan with transaction settings need a transaction, use database.WithTx",
+			))
+		}
+	}
+
+	callback := db.Callback()
+	commit := callbacks.CommitOrRollbackTransaction
+	for _, err := range []error{
+		callback.Create().After("gorm:begin_transaction").Register("fw:tx_settings", apply),
+		callback.Update().After("gorm:begin_transaction").Register("fw:tx_settings", apply),
+		callback.Delete().After("gorm:begin_transaction").Register("fw:tx_settings", apply),
+		callback.Query().Before("gorm:query").Register("fw:tx_settings", begin),
+		callback.Query().After("gorm:after_query").Register("fw:tx_settings_commit", commit),
+		callback.Raw().Before("gorm:raw").Register("fw:tx_settings", begin),
+		callback.Raw().After("gorm:raw").Register("fw:tx_settings_commit", commit),
+		callback.Row().Before("gorm:row").Register("fw:tx_settings", rejectOutsideTx),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,13 +1,20 @@
 package database_test
 
 import (
+	"context"
 	"database/sql"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 
 	"github.com/southernlabs-io/go-fw/config"
 	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
 	"github.com/southernlabs-io/go-fw/log"
 	"github.com/southernlabs-io/go-fw/test"
 )
@@ -78,3 +85,351 @@ func TestDBTx(t *testing.T) {
 	require.Nil(t, err)
 	require.EqualValues(t, 1, count)
 }
+
+func TestDBRollbackMode(t *testing.T) {
+	t.Run("parallel", func(t *testing.T) {
+		for _, name := range []string{"first", "second"} {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				var ctx context.Context
+				test.FxIntegration(t).WithDB(test.DBModeRollback).Populate(&ctx)
+
+				require.NoError(t, database.InTx(ctx).Exec("CREATE TABLE item (name text not null)").Error)
+				require.NoError(t, database.InTx(ctx).Exec("INSERT INTO item VALUES (?)", name).Error)
+				// Nested transactions are savepoints of the transaction of the test
+				subTx, _ := database.WithTx(ctx)
+				require.True(t, subTx.IsSub())
+				require.NoError(t, subTx.Exec("INSERT INTO item VALUES ('rolled back')").Error)
+				require.NoError(t, subTx.Rollback().Error)
+
+				var names []string
+				require.NoError(t, database.InTx(ctx).Raw("SELECT name FROM item").Scan(&names).Error)
+				require.Equal(t, []string{name}, names)
+			})
+		}
+	})
+
+	// The changes of the tests were rolled back
+	var ctx context.Context
+	test.FxIntegration(t).WithDB(test.DBModeRollback).Populate(&ctx)
+	var table sql.NullString
+	require.NoError(t, database.InTx(ctx).Raw("SELECT to_regclass('item')::text").Scan(&table).Error)
+	require.False(t, table.Valid)
+}
+
+func TestDBTxHooks(t *testing.T) {
+	var ctx context.Context
+	test.FxIntegration(t).WithDB().Populate(&ctx)
+	var events []string
+	hook := func(event string) database.TxHook {
+		return func(ctx context.Context) {
+			events = append(events, event)
+		}
+	}
+
+	tx, txCtx := database.WithTx(ctx)
+	tx.AfterCommit(func(ctx context.Context) {
+		// The transaction is closed when its hooks run
+		require.True(t, database.InTx(ctx).IsAutomatic())
+		events = append(events, "commit")
+	})
+	tx.AfterRollback(hook("rollback"))
+	released, _ := database.WithTx(txCtx)
+	released.AfterCommit(hook("released commit"))
+	released.AfterRollback(hook("released rollback"))
+	require.NoError(t, released.Commit().Error)
+	rolledBack, _ := database.WithTx(txCtx)
+	rolledBack.AfterCommit(hook("rolled back commit"))
+	rolledBack.AfterRollback(hook("rolled back rollback"))
+	require.NoError(t, rolledBack.Rollback().Error)
+	// Only the rolled back savepoint ran its hooks
+	require.Equal(t, []string{"rolled back rollback"}, events)
+
+	tx.AfterCommit(func(context.Context) { panic("hook panic") })
+	require.NoError(t, tx.Commit().Error)
+	require.Equal(t, []string{"rolled back rollback", "commit", "released commit"}, events)
+	require.Panics(t, func() { tx.AfterCommit(hook("closed")) })
+
+	events = nil
+	tx, txCtx = database.WithTx(ctx)
+	tx.AfterCommit(hook("commit"))
+	tx.AfterRollback(hook("rollback"))
+	released, _ = database.WithTx(txCtx)
+	released.AfterRollback(hook("released rollback"))
+	require.NoError(t, released.Commit().Error)
+	require.NoError(t, tx.Rollback().Error)
+	require.Equal(t, []string{"rollback", "released rollback"}, events)
+
+	// Automatic transactions commit every query
+	events = nil
+	automatic := database.InTx(ctx)
+	automatic.AfterRollback(hook("rollback"))
+	automatic.AfterCommit(hook("commit"))
+	require.Equal(t, []string{"commit"}, events)
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	require.False(t, database.IsRetryableTxError(nil))
+	require.False(t, database.IsRetryableTxError(&pgconn.PgError{Code: "23505"}))
+	require.True(t, database.IsRetryableTxError(&pgconn.PgError{Code: database.PgCodeSerializationFailure}))
+	require.True(t, database.IsRetryableTxError(errors.Newf(
+		database.ErrCodeCommitFailed,
+		"failed to commit trx: %w",
+		&pgconn.PgError{Code: database.PgCodeDeadlockDetected},
+	)))
+}
+
+func TestRunInTx(t *testing.T) {
+	var ctx context.Context
+	var conf config.Config
+	test.FxIntegration(t).WithDB().Populate(&ctx, &conf)
+	require.NoError(t, database.InTx(ctx).Exec("CREATE TABLE counter (value int not null)").Error)
+	require.NoError(t, database.InTx(ctx).Exec("INSERT INTO counter VALUES (0)").Error)
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+
+	// A real serialization failure: both read the counter before any of them updates it
+	var firstReads sync.WaitGroup
+	firstReads.Add(2)
+	var attempts atomic.Int32
+	increment := func() error {
+		first := true
+		return database.RunInTx(ctx, serializable, func(ctx context.Context) error {
+			attempts.Add(1)
+			var value int
+			if err := database.InTx(ctx).Raw("SELECT value FROM counter").Scan(&value).Error; err != nil {
+				return err
+			}
+			if first {
+				first = false
+				firstReads.Done()
+				firstReads.Wait()
+			}
+			return database.InTx(ctx).Exec("UPDATE counter SET value = ?", value+1).Error
+		})
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- increment() }()
+	go func() { errs <- increment() }()
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	require.Greater(t, attempts.Load(), int32(2))
+	var value int
+	require.NoError(t, database.InTx(ctx).Raw("SELECT value FROM counter").Scan(&value).Error)
+	require.Equal(t, 2, value)
+
+	// The retries are limited
+	attempt := 0
+	err := database.RunInTx(ctx, serializable, func(ctx context.Context) error {
+		attempt++
+		return &pgconn.PgError{Code: database.PgCodeDeadlockDetected}
+	})
+	require.True(t, errors.IsCode(err, database.ErrCodeTxRetriesExhausted))
+	require.Equal(t, conf.Database.TxMaxRetries+1, attempt)
+
+	// Other errors are not retried
+	attempt = 0
+	err = database.RunInTx(ctx, nil, func(ctx context.Context) error {
+		attempt++
+		return errors.Newf(errors.ErrCodeConflict, "conflict")
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+	require.Equal(t, 1, attempt)
+}
+
+func TestTranslateError(t *testing.T) {
+	require.NoError(t, database.TranslateError(nil))
+	plain := errors.NewUnknownf("plain")
+	require.Same(t, plain, database.TranslateError(plain))
+	other := &pgconn.PgError{Code: database.PgCodeSerializationFailure}
+	require.Same(t, other, database.TranslateError(other))
+
+	err := database.TranslateError(gorm.ErrRecordNotFound)
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotFound))
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	pgErr := &pgconn.PgError{
+		Code:           database.PgCodeUniqueViolation,
+		Message:        "duplicate key value violates unique constraint",
+		TableName:      "user",
+		ConstraintName: "user_email_key",
+	}
+	err = database.TranslateError(pgErr)
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+	require.ErrorContains(t, err, "unique violation, table: user, constraint: user_email_key")
+	var wrapped *pgconn.PgError
+	require.ErrorAs(t, err, &wrapped)
+	require.Same(t, pgErr, wrapped)
+
+	err = database.TranslateError(&pgconn.PgError{
+		Code:       database.PgCodeNotNullViolation,
+		TableName:  "user",
+		ColumnName: "email",
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+	require.ErrorContains(t, err, "not null violation, table: user, column: email")
+	require.True(t, errors.IsCode(
+		database.TranslateError(&pgconn.PgError{Code: database.PgCodeQueryCanceled}),
+		errors.ErrCodeTimeout,
+	))
+}
+
+func TestTranslateErrorStatements(t *testing.T) {
+	var ctx context.Context
+	test.FxIntegration(t).WithDB().Populate(&ctx)
+	type parent struct {
+		ID int
+	}
+	type child struct {
+		ID       int
+		Email    string `gorm:"uniqueIndex;not null"`
+		ParentID int
+		Parent   parent
+	}
+	db := database.InTx(ctx)
+	require.NoError(t, db.AutoMigrate(&parent{}, &child{}))
+	require.NoError(t, db.Create(&parent{ID: 1}).Error)
+	require.NoError(t, db.Create(&child{Email: "a@example.com", ParentID: 1}).Error)
+
+	// Each failing statement in its own sub transaction, so the errors don't abort the test transaction
+	run := func(fn func(db *gorm.DB) error) error {
+		tx, _ := database.WithTx(ctx)
+		defer tx.Rollback()
+		return fn(tx.DB)
+	}
+	err := run(func(db *gorm.DB) error {
+		return db.Create(&child{Email: "a@example.com", ParentID: 1}).Error
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeConflict))
+	require.ErrorContains(t, err, "constraint: idx_children_email")
+
+	err = run(func(db *gorm.DB) error {
+		return db.Create(&child{Email: "b@example.com", ParentID: 2}).Error
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+	require.ErrorContains(t, err, "foreign key violation")
+
+	err = run(func(db *gorm.DB) error {
+		return db.Exec("SELECT 'not a uuid'::uuid").Error
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+
+	err = run(func(db *gorm.DB) error {
+		if err := db.Exec("SET LOCAL statement_timeout = 10").Error; err != nil {
+			return err
+		}
+		return db.Exec("SELECT pg_sleep(1)").Error
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeTimeout))
+
+	err = run(func(db *gorm.DB) error {
+		return db.First(&child{}, "email = ?", "missing@example.com").Error
+	})
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotFound))
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestCreateDBName(t *testing.T) {
+	conf := config.Config{RootConfig: config.RootConfig{Name: "my-app", Env: config.EnvConfig{Name: "Dev1"}}}
+	require.Equal(t, "my_app_dev1", database.CreateDBName(conf))
+
+	conf.Database.DBName = "shared"
+	require.Equal(t, "shared", database.CreateDBName(conf))
+}
+
+func TestDBSettings(t *testing.T) {
+	test.IntegrationTest(t)
+
+	conf := test.NewTestConfig(test.NewTestRootConfig(t))
+	lf := test.NewLoggerFactory(t, conf.RootConfig)
+	conf.Database = config.DatabaseConfig{
+		Host:             "localhost",
+		Port:             5432,
+		User:             "postgres",
+		Pass:             "postgres",
+		ApplicationName:  "settings-test",
+		SSLMode:          "disable",
+		MaxOpenConns:     5,
+		MaxIdleConns:     3,
+		ConnMaxLifetime:  time.Minute,
+		ConnectTimeout:   5 * time.Second,
+		StatementTimeout: 1500 * time.Millisecond,
+	}
+	db := test.NewTestDatabase(conf, lf)
+	defer func(conf config.Config, lf *log.LoggerFactory, db database.DB) {
+		err := test.OnTestDBStop(conf, db, lf)
+		require.NoError(t, err)
+	}(conf, lf, db)
+
+	var applicationName, statementTimeout string
+	require.NoError(t, db.Raw("SHOW application_name").Scan(&applicationName).Error)
+	require.Equal(t, "settings-test", applicationName)
+	require.NoError(t, db.Raw("SHOW statement_timeout").Scan(&statementTimeout).Error)
+	require.Equal(t, "1500ms", statementTimeout)
+
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	require.Equal(t, 5, sqlDB.Stats().MaxOpenConnections)
+
+	conf.Database.MaxOpenConns = 10
+	require.NoError(t, db.ConfigurePool(conf.Database))
+	require.Equal(t, 10, sqlDB.Stats().MaxOpenConnections)
+}
+
+func TestReplicas(t *testing.T) {
+	test.IntegrationTest(t)
+
+	conf := test.NewTestConfig(test.NewTestRootConfig(t))
+	lf := test.NewLoggerFactory(t, conf.RootConfig)
+	conf.Database = config.DatabaseConfig{
+		Host: "localhost",
+		Port: 5432,
+		User: "postgres",
+		Pass: "postgres",
+		// The primary is also used as a replica, it is never in recovery so it has no lag
+		Replicas: []config.DatabaseReplicaConfig{{Host: "localhost"}, {Host: "unknown.invalid"}},
+	}
+	db := test.NewTestDatabase(conf, lf)
+	defer func(conf config.Config, lf *log.LoggerFactory, db database.DB) {
+		err := test.OnTestDBStop(conf, db, lf)
+		require.NoError(t, err)
+	}(conf, lf, db)
+	ctx := test.NewContext(db, lf)
+
+	statuses := db.Replicas().Status()
+	require.Len(t, statuses, 2)
+	require.True(t, statuses[0].Healthy)
+	require.False(t, statuses[1].Healthy)
+	require.Error(t, statuses[1].Err)
+	require.NoError(t, db.Replicas().HealthCheck())
+
+	primary, err := db.DB.DB()
+	require.NoError(t, err)
+	replica, err := db.Replica().DB()
+	require.NoError(t, err)
+	require.NotSame(t, primary, replica)
+
+	// Only the healthy replica is in rotation
+	for range 3 {
+		readDB, err := database.GetDBFromCtx(database.ReadOnly(ctx)).DB()
+		require.NoError(t, err)
+		require.Same(t, replica, readDB)
+	}
+	writeDB, err := database.GetDBFromCtx(ctx).DB()
+	require.NoError(t, err)
+	require.Same(t, primary, writeDB)
+
+	// Open transactions stay on the primary
+	tx, txCtx := database.WithTx(ctx)
+	require.Same(t, tx, database.InTx(database.ReadOnly(txCtx)))
+	txDB, err := database.GetDBFromCtx(database.ReadOnly(txCtx)).DB()
+	require.NoError(t, err)
+	require.Same(t, primary, txDB)
+	require.NoError(t, tx.Rollback().Error)
+
+	// Read-only transactions go to a replica
+	roTx, _ := database.WithTx(ctx, &sql.TxOptions{ReadOnly: true})
+	var readOnly string
+	require.NoError(t, roTx.Raw("SHOW transaction_read_only").Scan(&readOnly).Error)
+	require.Equal(t, "on", readOnly)
+	require.NoError(t, roTx.Rollback().Error)
+}
@@ -0,0 +1,201 @@
+package migrate
+
+import (
+	"database/sql"
+	"io/fs"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/distributedlock"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// lockTTL is the TTL of the distributed lock held while migrating, it is extended until the migrations finish.
+const lockTTL = time.Minute
+
+/*
+Migrations are the goose migrations of the app: the SQL files in Dir inside FS, usually an embed.FS, and the Go
+migrations registered with goose.AddMigrationContext. Supply them with Provide:
+
+	//go:embed migrations/*.sql
+	var migrationsFS embed.FS
+
+	migrate.Provide(migrationsFS, "migrations")
+*/
+type Migrations struct {
+	FS  fs.FS
+	Dir string
+}
+
+// Provide supplies the migrations in the dir of fsys.
+func Provide(fsys fs.FS, dir string) fx.Option {
+	return fx.Supply(Migrations{FS: fsys, Dir: dir})
+}
+
+// Migrator runs the Migrations in the database.
+type Migrator struct {
+	db       database.DB
+	provider *goose.Provider
+}
+
+func NewMigrator(db database.DB, migrations Migrations, lf *log.LoggerFactory) (*Migrator, error) {
+	if migrations.FS == nil {
+		return nil, errNoMigrations
+	}
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to get the sql.DB, error: %w", err)
+	}
+	provider, err := newProvider(
+		sqlDB,
+		migrations,
+		goose.WithVerbose(true),
+		goose.WithLogger(database.NewGooseLogger(lf.GetLoggerForType(Migrator{}))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, provider: provider}, nil
+}
+
+var errNoMigrations = errors.Newf(errors.ErrCodeBadArgument, "no migrations provided, use migrate.Provide")
+
+// Sources returns the SQL migrations of the migrations, and the Go migrations registered in goose, like with
+// goose.AddMigrationContext, sorted by version. The path of a Go migration is the file that registered it.
+func Sources(migrations Migrations) ([]*goose.Source, error) {
+	// The provider doesn't connect to the database until it migrates
+	sqlDB, err := sql.Open("pgx", "")
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to open the sql.DB, error: %w", err)
+	}
+	defer func() { _ = sqlDB.Close() }()
+	provider, err := newProvider(sqlDB, migrations)
+	if err != nil {
+		return nil, err
+	}
+	return provider.ListSources(), nil
+}
+
+func newProvider(sqlDB *sql.DB, migrations Migrations, opts ...goose.ProviderOption) (*goose.Provider, error) {
+	if migrations.FS == nil {
+		return nil, errNoMigrations
+	}
+	fsys := migrations.FS
+	if migrations.Dir != "" && migrations.Dir != "." {
+		var err error
+		if fsys, err = fs.Sub(fsys, migrations.Dir); err != nil {
+			return nil, errors.NewUnknownf("invalid migrations dir: %s, error: %w", migrations.Dir, err)
+		}
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, sqlDB, fsys, opts...)
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to load the migrations, error: %w", err)
+	}
+	return provider, nil
+}
+
+// Up applies all the pending migrations.
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		return results, errors.NewUnknownf("failed to apply the migrations, error: %w", err)
+	}
+	return results, nil
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+	if err != nil {
+		return result, errors.NewUnknownf("failed to roll back the migration, error: %w", err)
+	}
+	return result, nil
+}
+
+// Redo rolls back the last applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	down, err := m.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+	up, err := m.provider.UpByOne(ctx)
+	if err != nil {
+		return []*goose.MigrationResult{down, up}, errors.NewUnknownf(
+			"failed to apply again the migration, error: %w",
+			err,
+		)
+	}
+	return []*goose.MigrationResult{down, up}, nil
+}
+
+// Status returns the status of every migration, sorted by version.
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to get the status of the migrations, error: %w", err)
+	}
+	return statuses, nil
+}
+
+// Version returns the version of the last applied migration, 0 if there are none.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return 0, errors.NewUnknownf("failed to get the version of the database, error: %w", err)
+	}
+	return version, nil
+}
+
+// UpWithLock applies all the pending migrations holding a distributed lock, so only one instance of the app migrates.
+// The others wait for it to finish, and then have nothing to apply.
+func (m *Migrator) UpWithLock(ctx context.Context, lockFactory distributedlock.Factory) (err error) {
+	// The Postgres lock uses the DB of the context
+	if database.GetDBFromCtx(ctx) == nil {
+		ctx = m.db.SetCtx(ctx)
+	}
+	dLock := lockFactory.NewDistributedLock("migrate_"+m.db.DbName, lockTTL)
+	if err = dLock.Lock(ctx); err != nil {
+		return errors.NewUnknownf("failed to lock the migrations, error: %w", err)
+	}
+	defer func() {
+		if unlockErr := dLock.Unlock(ctx); unlockErr != nil && err == nil {
+			err = errors.NewUnknownf("failed to unlock the migrations, error: %w", unlockErr)
+		}
+	}()
+	lockedCtx, err := dLock.AutoExtend(ctx)
+	if err != nil {
+		return errors.NewUnknownf("failed to extend the lock of the migrations, error: %w", err)
+	}
+	_, err = m.Up(lockedCtx)
+	return err
+}
+
+// MigrateOnStart applies the pending migrations when the app starts, before the components started after it, like the
+// HTTP server. Only one instance migrates at a time, see Migrator.UpWithLock.
+func MigrateOnStart(deps struct {
+	fx.In
+
+	Migrator    *Migrator
+	LockFactory distributedlock.Factory
+	LF          *log.LoggerFactory
+	Lifecycle   fx.Lifecycle
+}) {
+	deps.Lifecycle.Append(fx.StartHook(func(ctx context.Context) error {
+		return deps.Migrator.UpWithLock(deps.LF.SetCtx(ctx), deps.LockFactory)
+	}))
+}
+
+// Module provides the Migrator of the Migrations supplied with Provide, it requires database.Module.
+var Module = fx.Provide(NewMigrator)
+
+// ModuleOnStart applies the migrations on start, see MigrateOnStart. It requires a distributedlock.Factory, like
+// distributedlock.ModulePostgres.
+var ModuleOnStart = fx.Options(
+	Module,
+	fx.Invoke(MigrateOnStart),
+)
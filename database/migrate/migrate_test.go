@@ -0,0 +1,135 @@
+package migrate_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/database/migrate"
+	"github.com/southernlabs-io/go-fw/distributedlock"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+func TestNewMigratorWithoutMigrations(t *testing.T) {
+	_, err := migrate.NewMigrator(database.DB{}, migrate.Migrations{}, log.NewLoggerFactory(config.RootConfig{}))
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+}
+
+func TestSources(t *testing.T) {
+	sources, err := migrate.Sources(migrate.Migrations{FS: os.DirFS("testdata"), Dir: "migrations"})
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, goose.TypeSQL, sources[0].Type)
+	require.EqualValues(t, 1, sources[0].Version)
+	require.EqualValues(t, 2, sources[1].Version)
+
+	_, err = migrate.Sources(migrate.Migrations{})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+}
+
+func TestMigrator(t *testing.T) {
+	var ctx context.Context
+	var db database.DB
+	var migrator *migrate.Migrator
+	test.FxIntegrationWithDB(
+		t,
+		migrate.Provide(os.DirFS("testdata"), "migrations"),
+		migrate.Module,
+	).Populate(&ctx, &db, &migrator)
+
+	// The test database is already migrated
+	version, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version)
+	require.NoError(t, db.Exec("INSERT INTO item (name, price) VALUES ('one', 1)").Error)
+
+	result, err := migrator.Down(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Source.Version)
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	require.Equal(t, goose.StateApplied, statuses[0].State)
+	require.Equal(t, goose.StatePending, statuses[1].State)
+
+	results, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	results, err = migrator.Redo(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "down", results[0].Direction)
+	require.Equal(t, "up", results[1].Direction)
+
+	require.NoError(t, migrator.UpWithLock(ctx, distributedlock.NewLocalFactory()))
+	require.NoError(t, migrator.UpWithLock(ctx, distributedlock.NewPostgresFactory()))
+	version, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version)
+}
+
+func TestTestDatabaseTemplate(t *testing.T) {
+	test.IntegrationTest(t)
+	migrations := migrate.Migrations{FS: os.DirFS("testdata"), Dir: "migrations"}
+	newDB := func(t *testing.T, migrations migrate.Migrations) database.DB {
+		rootConf := test.NewTestRootConfig(t)
+		conf := test.NewTestConfig(rootConf)
+		lf := test.NewLoggerFactory(t, rootConf)
+		db := test.NewTestDatabase(conf, lf, migrations)
+		t.Cleanup(func() { require.NoError(t, test.OnTestDBStop(conf, db, lf)) })
+		return db
+	}
+	templates := func(t *testing.T, db database.DB) []string {
+		var names []string
+		require.NoError(t, db.Raw("SELECT datname FROM pg_database WHERE datistemplate AND datname LIKE 'tpl\\_%'").
+			Scan(&names).Error)
+		return names
+	}
+
+	var template []string
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			db := newDB(t, migrations)
+			require.NoError(t, db.Exec("INSERT INTO item (name, price) VALUES ('one', 1)").Error)
+			if template == nil {
+				template = templates(t, db)
+				require.Len(t, template, 1)
+			}
+			// The clones share the template, and don't see the changes of each other
+			require.Equal(t, template, templates(t, db))
+			var count int64
+			require.NoError(t, db.Raw("SELECT count(*) FROM item").Scan(&count).Error)
+			require.EqualValues(t, 1, count)
+		})
+	}
+
+	t.Run("changed", func(t *testing.T) {
+		changed := fstest.MapFS{}
+		for _, name := range []string{"00001_create_item.sql", "00002_add_item_price.sql"} {
+			content, err := os.ReadFile("testdata/migrations/" + name)
+			require.NoError(t, err)
+			changed[name] = &fstest.MapFile{Data: content}
+		}
+		changed["00003_add_item_stock.sql"] = &fstest.MapFile{Data: []byte(`-- +goose Up
+ALTER TABLE item ADD COLUMN stock INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE item DROP COLUMN stock;
+`)}
+		db := newDB(t, migrate.Migrations{FS: changed})
+		require.NoError(t, db.Exec("INSERT INTO item (name, price, stock) VALUES ('one', 1, 1)").Error)
+		// The stale template was dropped
+		newTemplate := templates(t, db)
+		require.Len(t, newTemplate, 1)
+		require.NotEqual(t, template, newTemplate)
+	})
+}
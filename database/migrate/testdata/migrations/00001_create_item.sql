@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE item (
+    id   BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE item;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE item ADD COLUMN price NUMERIC NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE item DROP COLUMN price;
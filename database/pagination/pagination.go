@@ -0,0 +1,273 @@
+/*
+Package pagination paginates GORM queries with keyset pagination: a page has the rows that come after, or before, the
+last row of the previous page in the order of the query, so the pages are stable while rows are inserted and deleted,
+and fast at any depth.
+
+The position of a page is an opaque cursor, signed with config.PaginationConfig.CursorKey so the clients can't tamper
+with it:
+
+	result, err := pagination.Find[User](
+		database.InTx(ctx).Where("active"),
+		paginator,
+		page,
+		pagination.Column{Name: "created_at", Desc: true},
+		pagination.Column{Name: "id", Desc: true},
+	)
+
+See rest.BindPage and rest.NewPageResponse to paginate a REST endpoint.
+*/
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// Column is a column of the order of the pages. The values of the columns must identify every row, so the last column
+// must be unique, like the primary key, and none of them can be NULL.
+type Column struct {
+	// Name is the column in the query, like "created_at" or "users.created_at".
+	Name string
+	// Field is the field of the model with the value of the column. Empty means the field of the column Name, without
+	// the table.
+	Field string
+	Desc  bool
+}
+
+// Page selects a page. Only one of After and Before can be set, and when none is, it is the first page.
+type Page struct {
+	// Size is the maximum number of rows of the page, 0 means config.PaginationConfig.DefaultSize.
+	Size int
+	// After is the Result.Next cursor of the previous page, to get the rows that come after it.
+	After string
+	// Before is the Result.Prev cursor of the next page, to get the rows that come before it.
+	Before string
+}
+
+// Result is a page of rows.
+type Result[T any] struct {
+	Items []T
+	// Next is the cursor to get the next page with Page.After, it is empty on the last page.
+	Next string
+	// Prev is the cursor to get the previous page with Page.Before, it is empty on the first page.
+	Prev string
+}
+
+// Paginator paginates the queries, with the sizes and the cursor key of config.PaginationConfig.
+type Paginator struct {
+	key         []byte
+	defaultSize int
+	maxSize     int
+}
+
+func NewPaginator(conf config.Config) Paginator {
+	if conf.Pagination.CursorKey == "" {
+		panic(errors.Newf(errors.ErrCodeBadState, "pagination cursor key not set in config"))
+	}
+
+	key, err := hex.DecodeString(conf.Pagination.CursorKey)
+	if err != nil {
+		panic(errors.NewUnknownf("could not hex decode pagination cursor key, error: %w", err))
+	}
+
+	return Paginator{key, conf.Pagination.DefaultSize, conf.Pagination.MaxSize}
+}
+
+/*
+Find runs the query for the page, ordered by the columns, and returns its rows, with the cursors of the next and
+previous pages. The query must not have an order nor a limit, Find adds them.
+
+It fails with errors.ErrCodeBadArgument if the size is above config.PaginationConfig.MaxSize, both cursors are set, or
+a cursor was not created by a Paginator with the same key for the same columns.
+*/
+func Find[T any](db *gorm.DB, p Paginator, page Page, columns ...Column) (Result[T], error) {
+	var result Result[T]
+	if len(columns) == 0 {
+		return result, errors.Newf(errors.ErrCodeBadState, "pagination needs at least one column")
+	}
+	size := page.Size
+	if size == 0 {
+		size = p.defaultSize
+	}
+	if size < 1 || size > p.maxSize {
+		return result, errors.Newf(errors.ErrCodeBadArgument, "page size must be between 1 and %d", p.maxSize)
+	}
+	if page.After != "" && page.Before != "" {
+		return result, errors.Newf(errors.ErrCodeBadArgument, "page after and before can't be used together")
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return result, errors.NewUnknownf("failed to parse the model: %T, error: %w", *new(T), err)
+	}
+	fields := make([]*schema.Field, len(columns))
+	for i, column := range columns {
+		name := column.Field
+		if name == "" {
+			name = column.Name[strings.LastIndexByte(column.Name, '.')+1:]
+		}
+		if fields[i] = stmt.Schema.LookUpField(name); fields[i] == nil {
+			return result, errors.Newf(
+				errors.ErrCodeBadState,
+				"model: %s has no field for pagination column: %s",
+				stmt.Schema.Name,
+				column.Name,
+			)
+		}
+	}
+
+	backward := page.Before != ""
+	query := db
+	if cursor := page.After + page.Before; cursor != "" {
+		values, err := p.decodeCursor(cursor, columns, fields)
+		if err != nil {
+			return result, err
+		}
+		query = query.Where(keysetCondition(columns, values, backward))
+	}
+	orderBy := clause.OrderBy{Columns: make([]clause.OrderByColumn, len(columns))}
+	for i, column := range columns {
+		orderBy.Columns[i] = clause.OrderByColumn{
+			Column: clause.Column{Name: column.Name},
+			Desc:   column.Desc != backward,
+		}
+	}
+	// One more row tells if there is another page
+	if err := query.Clauses(orderBy).Limit(size + 1).Find(&result.Items).Error; err != nil {
+		return result, errors.NewUnknownf("failed to find the page, error: %w", err)
+	}
+
+	more := len(result.Items) > size
+	if more {
+		result.Items = result.Items[:size]
+	}
+	if backward {
+		slices.Reverse(result.Items)
+	}
+	if len(result.Items) == 0 {
+		return result, nil
+	}
+	var err error
+	// Going backward there is always a next page, going forward there is a previous one if it started after a cursor
+	if more || backward {
+		if result.Next, err = p.encodeCursor(db, result.Items[len(result.Items)-1], columns, fields); err != nil {
+			return result, err
+		}
+	}
+	if more && backward || page.After != "" {
+		if result.Prev, err = p.encodeCursor(db, result.Items[0], columns, fields); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// keysetCondition selects the rows after the values in the order of the columns, or before them when backward:
+// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ...
+func keysetCondition(columns []Column, values []any, backward bool) clause.Expr {
+	var sql strings.Builder
+	var vars []any
+	for i, column := range columns {
+		if i > 0 {
+			sql.WriteString(" OR ")
+		}
+		sql.WriteString("(")
+		for j := range i {
+			sql.WriteString("? = ? AND ")
+			vars = append(vars, clause.Column{Name: columns[j].Name}, values[j])
+		}
+		if column.Desc != backward {
+			sql.WriteString("? < ?)")
+		} else {
+			sql.WriteString("? > ?)")
+		}
+		vars = append(vars, clause.Column{Name: column.Name}, values[i])
+	}
+	return clause.Expr{SQL: "(" + sql.String() + ")", Vars: vars}
+}
+
+// encodeCursor returns the cursor of the row: its values of the columns in JSON, and their signature, both base64
+// encoded and separated by a dot.
+func (p Paginator) encodeCursor(db *gorm.DB, row any, columns []Column, fields []*schema.Field) (string, error) {
+	rowValue := reflect.ValueOf(row)
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		values[i], _ = field.ValueOf(db.Statement.Context, rowValue)
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.NewUnknownf("failed to marshal the cursor, error: %w", err)
+	}
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(p.sign(payload, columns)), nil
+}
+
+// decodeCursor verifies the signature of the cursor, and returns its values, with the types of the fields.
+func (p Paginator) decodeCursor(cursor string, columns []Column, fields []*schema.Field) ([]any, error) {
+	encoding := base64.RawURLEncoding
+	encodedPayload, encodedSignature, found := strings.Cut(cursor, ".")
+	if !found {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid page cursor")
+	}
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid page cursor, error: %w", err)
+	}
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, p.sign(payload, columns)) {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid page cursor signature")
+	}
+
+	var rawValues []json.RawMessage
+	if err = json.Unmarshal(payload, &rawValues); err != nil || len(rawValues) != len(fields) {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid page cursor values")
+	}
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		value := reflect.New(field.FieldType)
+		if err = json.Unmarshal(rawValues[i], value.Interface()); err != nil {
+			return nil, errors.Newf(
+				errors.ErrCodeBadArgument,
+				"invalid page cursor value of: %s, error: %w",
+				columns[i].Name,
+				err,
+			)
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// sign returns the HMAC of the payload and the columns, so a cursor is only valid for the order it was created with.
+func (p Paginator) sign(payload []byte, columns []Column) []byte {
+	var order bytes.Buffer
+	for _, column := range columns {
+		order.WriteString(column.Name)
+		if column.Desc {
+			order.WriteString(" DESC")
+		}
+		order.WriteByte(0)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(order.Bytes())
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Module provides the Paginator.
+var Module = fx.Provide(NewPaginator)
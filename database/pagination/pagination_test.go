@@ -0,0 +1,94 @@
+package pagination_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/database/pagination"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+type item struct {
+	ID        int
+	CreatedAt time.Time
+}
+
+func newPaginator() pagination.Paginator {
+	return pagination.NewPaginator(config.Config{
+		Pagination: config.PaginationConfig{CursorKey: "dabbad00", DefaultSize: 2, MaxSize: 3},
+	})
+}
+
+func TestNewPaginator(t *testing.T) {
+	require.Panics(t, func() { pagination.NewPaginator(config.Config{}) })
+	require.Panics(t, func() {
+		pagination.NewPaginator(config.Config{Pagination: config.PaginationConfig{CursorKey: "not hex"}})
+	})
+}
+
+func TestFindBadArguments(t *testing.T) {
+	paginator := newPaginator()
+	column := pagination.Column{Name: "id"}
+	_, err := pagination.Find[item](nil, paginator, pagination.Page{Size: 4}, column)
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+	_, err = pagination.Find[item](nil, paginator, pagination.Page{Size: -1}, column)
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+	_, err = pagination.Find[item](nil, paginator, pagination.Page{After: "a", Before: "b"}, column)
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+}
+
+func TestFind(t *testing.T) {
+	var ctx context.Context
+	test.FxIntegration(t).WithDB().Populate(&ctx)
+	db := database.InTx(ctx)
+	require.NoError(t, db.AutoMigrate(&item{}))
+	// Two items per timestamp, so the id breaks the ties
+	start := time.UnixMicro(time.Now().UnixMicro()).UTC()
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, db.Create(&item{ID: i, CreatedAt: start.Add(time.Duration(i/2) * time.Second)}).Error)
+	}
+
+	paginator := newPaginator()
+	columns := []pagination.Column{{Name: "created_at", Desc: true}, {Name: "items.id", Desc: true}}
+	find := func(page pagination.Page) ([]int, pagination.Result[item]) {
+		result, err := pagination.Find[item](database.InTx(ctx).DB, paginator, page, columns...)
+		require.NoError(t, err)
+		var ids []int
+		for _, it := range result.Items {
+			ids = append(ids, it.ID)
+		}
+		return ids, result
+	}
+
+	ids, first := find(pagination.Page{})
+	require.Equal(t, []int{5, 4}, ids)
+	require.Empty(t, first.Prev)
+	ids, second := find(pagination.Page{After: first.Next})
+	require.Equal(t, []int{3, 2}, ids)
+	ids, last := find(pagination.Page{After: second.Next})
+	require.Equal(t, []int{1}, ids)
+	require.Empty(t, last.Next)
+
+	// Back to the first page
+	ids, result := find(pagination.Page{Before: last.Prev})
+	require.Equal(t, []int{3, 2}, ids)
+	require.Equal(t, second.Next, result.Next)
+	ids, result = find(pagination.Page{Before: result.Prev})
+	require.Equal(t, []int{5, 4}, ids)
+	require.Empty(t, result.Prev)
+	require.NotEmpty(t, result.Next)
+
+	// Tampered cursors, and cursors of another order, are rejected
+	tampered := []byte(first.Next)
+	tampered[0] ^= 1
+	_, err := pagination.Find[item](db.DB, paginator, pagination.Page{After: string(tampered)}, columns...)
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+	_, err = pagination.Find[item](db.DB, paginator, pagination.Page{After: first.Next}, pagination.Column{Name: "id"})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+}
@@ -30,4 +30,8 @@ const (
 
 	// ErrCodeConflict is used when there is a conflict with the current state. This error will be mapped to HTTP 409.
 	ErrCodeConflict = "CONFLICT"
+
+	// ErrCodeTimeout is used when an operation didn't complete in time, like a DB statement canceled by its timeout.
+	// This error will be mapped to HTTP 504.
+	ErrCodeTimeout = "TIMEOUT"
 )
@@ -0,0 +1,383 @@
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/rest/middleware"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+// FlagsCtxKey is the key of the Flags used by the package functions, like IsEnabled, when set in the context.
+var FlagsCtxKey = context.CtxKey("_fw_flags")
+
+var attributesCtxKey = context.CtxKey("_fw_flags_attributes")
+
+// Built-in attributes, they are always set when evaluating a flag, and can't be overwritten with WithAttributes.
+const (
+	AttrPrincipalID   = "principalId"
+	AttrPrincipalType = "principalType"
+	AttrEnvType       = "envType"
+	AttrEnvName       = "envName"
+)
+
+// Reasons of an Evaluation
+const (
+	ReasonNotFound   = "NOT_FOUND"
+	ReasonEnvType    = "ENV_TYPE"
+	ReasonAttributes = "ATTRIBUTES"
+	ReasonBoolean    = "BOOLEAN"
+	ReasonPrincipal  = "NO_PRINCIPAL"
+	ReasonPercentage = "PERCENTAGE"
+	ReasonAllowList  = "ALLOW_LIST"
+	ReasonVariant    = "VARIANT"
+)
+
+// buckets is the number of buckets the principals are hashed to, it allows percentages with two decimals.
+const buckets = 10_000
+
+// Evaluation is the result of evaluating a flag.
+type Evaluation struct {
+	Flag    string
+	Enabled bool
+	// Variant is the variant assigned to the principal, only for config.FlagTypeVariant flags.
+	Variant string
+	// Reason is why the flag has this result, one of the Reason constants.
+	Reason string
+}
+
+/*
+Flags evaluates the feature flags defined in config.FlagsConfig, and the ones loaded from a Store, which override the
+config ones with the same name.
+
+The flags are evaluated with the principal set in the context by middleware.SetPrincipal, the env type and the
+attributes set with WithAttributes:
+  - A flag restricted with EnvTypes or Attributes is off if they don't match.
+  - config.FlagTypeBoolean flags are on if Enabled.
+  - config.FlagTypePercentage flags are on for the Percentage of the principals, by hashing the flag name and the
+    principal ID. The same principal always gets the same result, and it keeps it when the percentage is increased.
+  - config.FlagTypeAllowList flags are on for the principals with an ID in Principals.
+  - config.FlagTypeVariant flags are on if the principal gets one of the Variants, hashed like the percentage.
+
+Unknown flags are off. Every evaluation is logged at debug level with the logger of the context.
+*/
+type Flags struct {
+	env             config.EnvConfig
+	store           Store
+	refreshInterval time.Duration
+
+	definitions      atomic.Pointer[map[string]config.FlagConfig]
+	storeDefinitions atomic.Pointer[map[string]config.FlagConfig]
+
+	mu      sync.Mutex
+	stopChn chan struct{}
+	doneChn chan struct{}
+}
+
+// NewFlags creates the Flags defined in conf. The store is optional, it is loaded with Refresh, or periodically after
+// Start.
+func NewFlags(conf config.Config, store Store) *Flags {
+	f := &Flags{
+		env:             conf.Env,
+		store:           store,
+		refreshInterval: conf.Flags.RefreshInterval,
+	}
+	f.Update(conf.Flags)
+	return f
+}
+
+// Update replaces the flags defined in the config. The ones loaded from the Store are kept.
+func (f *Flags) Update(conf config.FlagsConfig) {
+	definitions := maps.Clone(conf.Definitions)
+	f.definitions.Store(&definitions)
+}
+
+// Refresh loads the flags from the Store. The previous ones are kept if it fails. It does nothing without a Store.
+func (f *Flags) Refresh(ctx context.Context) error {
+	if f.store == nil {
+		return nil
+	}
+	definitions, err := f.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	f.storeDefinitions.Store(&definitions)
+	return nil
+}
+
+// Start loads the flags from the Store, and then refreshes them in the background every
+// config.FlagsConfig.RefreshInterval. It does nothing without a Store.
+func (f *Flags) Start(ctx context.Context) error {
+	if f.store == nil {
+		return nil
+	}
+	logger := log.GetLoggerFromCtx(ctx)
+	if err := f.Refresh(ctx); err != nil {
+		logger.Warnf("Failed to load the flags from the store, using the config ones, error: %s", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopChn != nil || f.refreshInterval <= 0 {
+		return nil
+	}
+	f.stopChn = make(chan struct{})
+	f.doneChn = make(chan struct{})
+	go func(stopChn, doneChn chan struct{}) {
+		defer close(doneChn)
+		ticker := time.NewTicker(f.refreshInterval)
+		defer ticker.Stop()
+		refreshCtx := context.NoDeadlineAndNotCancellableContext(ctx)
+		for {
+			select {
+			case <-stopChn:
+				return
+			case <-ticker.C:
+				if err := f.Refresh(refreshCtx); err != nil {
+					logger.Warnf("Failed to refresh the flags from the store, keeping the previous ones, error: %s", err)
+				}
+			}
+		}
+	}(f.stopChn, f.doneChn)
+	return nil
+}
+
+// Stop stops the background refresh started by Start.
+func (f *Flags) Stop(context.Context) error {
+	f.mu.Lock()
+	stopChn, doneChn := f.stopChn, f.doneChn
+	f.stopChn, f.doneChn = nil, nil
+	f.mu.Unlock()
+	if stopChn != nil {
+		close(stopChn)
+		<-doneChn
+	}
+	return nil
+}
+
+// Definition returns the definition of the flag, from the Store or the config.
+func (f *Flags) Definition(name string) (config.FlagConfig, bool) {
+	if storeDefinitions := f.storeDefinitions.Load(); storeDefinitions != nil {
+		if definition, found := (*storeDefinitions)[name]; found {
+			return definition, true
+		}
+	}
+	definition, found := (*f.definitions.Load())[name]
+	return definition, found
+}
+
+// SetCtx sets f as the Flags used by the package functions with the returned context.
+func (f *Flags) SetCtx(ctx context.Context) context.Context {
+	return context.CtxSetValue(ctx, FlagsCtxKey, f)
+}
+
+// IsEnabled returns whether the flag is on, see Evaluate.
+func (f *Flags) IsEnabled(ctx context.Context, name string) bool {
+	return f.Evaluate(ctx, name).Enabled
+}
+
+// Variant returns the variant of the flag assigned to the principal, or an empty string if the flag is off.
+func (f *Flags) Variant(ctx context.Context, name string) string {
+	return f.Evaluate(ctx, name).Variant
+}
+
+// Evaluate evaluates the flag for the principal and attributes of the context.
+func (f *Flags) Evaluate(ctx context.Context, name string) Evaluation {
+	evaluation := f.evaluate(ctx, name)
+	logger := log.GetLoggerFromCtx(ctx)
+	if logger.Enabled(config.LogLevelDebug) {
+		logger.LogAttrs(config.LogLevelDebug, "Feature flag evaluated", slog.Group("flag",
+			slog.String("name", evaluation.Flag),
+			slog.Bool("enabled", evaluation.Enabled),
+			slog.String("variant", evaluation.Variant),
+			slog.String("reason", evaluation.Reason),
+		))
+	}
+	return evaluation
+}
+
+func (f *Flags) evaluate(ctx context.Context, name string) Evaluation {
+	evaluation := Evaluation{Flag: name}
+	definition, found := f.Definition(name)
+	if !found {
+		evaluation.Reason = ReasonNotFound
+		return evaluation
+	}
+
+	if len(definition.EnvTypes) > 0 && !slices.Contains(definition.EnvTypes, f.env.Type) {
+		evaluation.Reason = ReasonEnvType
+		return evaluation
+	}
+	attributes := f.attributes(ctx)
+	for attr, values := range definition.Attributes {
+		if value, present := attributes[attr]; !present || !slices.Contains(values, value) {
+			evaluation.Reason = ReasonAttributes
+			return evaluation
+		}
+	}
+
+	principalID, hasPrincipal := attributes[AttrPrincipalID]
+	switch definition.Type {
+	case config.FlagTypePercentage:
+		evaluation.Reason = ReasonPercentage
+		if definition.Percentage >= 100 {
+			evaluation.Enabled = true
+		} else if !hasPrincipal {
+			evaluation.Reason = ReasonPrincipal
+		} else {
+			evaluation.Enabled = float64(bucket(name, principalID)) < definition.Percentage*buckets/100
+		}
+	case config.FlagTypeAllowList:
+		evaluation.Reason = ReasonAllowList
+		evaluation.Enabled = hasPrincipal && slices.Contains(definition.Principals, principalID)
+	case config.FlagTypeVariant:
+		evaluation.Reason = ReasonVariant
+		if !hasPrincipal {
+			evaluation.Reason = ReasonPrincipal
+			break
+		}
+		evaluation.Variant = variant(definition.Variants, bucket(name, principalID))
+		evaluation.Enabled = evaluation.Variant != ""
+	default:
+		evaluation.Reason = ReasonBoolean
+		evaluation.Enabled = definition.Enabled
+	}
+	return evaluation
+}
+
+// attributes returns the attributes set with WithAttributes and the built-in ones.
+func (f *Flags) attributes(ctx context.Context) map[string]string {
+	attributes := make(map[string]string)
+	if ctxAttributes, present := ctx.Value(attributesCtxKey).(map[string]string); present {
+		maps.Copy(attributes, ctxAttributes)
+	}
+	attributes[AttrEnvType] = string(f.env.Type)
+	attributes[AttrEnvName] = f.env.Name
+	delete(attributes, AttrPrincipalID)
+	delete(attributes, AttrPrincipalType)
+	if principal, present := ctx.Value(middleware.PrincipalCtxKey).(middleware.Principal); present && principal != nil {
+		attributes[AttrPrincipalID] = fmt.Sprint(principal.GetID())
+		attributes[AttrPrincipalType] = string(principal.GetType())
+	}
+	return attributes
+}
+
+// bucket hashes the flag name and the principal ID to a number between 0 and buckets-1.
+func bucket(name, principalID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(principalID))
+	return h.Sum32() % buckets
+}
+
+// variant returns the variant of the bucket, the variants take consecutive ranges of buckets sorted by name. It returns
+// an empty string if the bucket is after all the variants.
+func variant(variants map[string]float64, b uint32) string {
+	var upper float64
+	for _, name := range slices.Sorted(maps.Keys(variants)) {
+		upper += variants[name] * buckets / 100
+		if float64(b) < upper {
+			return name
+		}
+	}
+	return ""
+}
+
+// WithAttributes returns a context with the attributes added to the ones used to evaluate the flags.
+func WithAttributes(ctx context.Context, attributes map[string]string) context.Context {
+	merged := make(map[string]string, len(attributes))
+	if ctxAttributes, present := ctx.Value(attributesCtxKey).(map[string]string); present {
+		maps.Copy(merged, ctxAttributes)
+	}
+	maps.Copy(merged, attributes)
+	return context.CtxSetValue(ctx, attributesCtxKey, merged)
+}
+
+var defaultFlags atomic.Pointer[Flags]
+
+// SetDefault sets the Flags used by the package functions when there is none in the context. It is called by Module.
+func SetDefault(f *Flags) {
+	defaultFlags.Store(f)
+}
+
+// GetFlagsFromCtx returns the Flags set in the context, or the default one. It returns nil if there is none.
+func GetFlagsFromCtx(ctx context.Context) *Flags {
+	if f, is := ctx.Value(FlagsCtxKey).(*Flags); is {
+		return f
+	}
+	return defaultFlags.Load()
+}
+
+// IsEnabled returns whether the flag is on with the Flags of the context, see Flags.Evaluate. It returns false if there
+// are no Flags.
+func IsEnabled(ctx context.Context, name string) bool {
+	return Evaluate(ctx, name).Enabled
+}
+
+// Variant returns the variant of the flag with the Flags of the context, see Flags.Variant.
+func Variant(ctx context.Context, name string) string {
+	return Evaluate(ctx, name).Variant
+}
+
+// Evaluate evaluates the flag with the Flags of the context, see Flags.Evaluate.
+func Evaluate(ctx context.Context, name string) Evaluation {
+	f := GetFlagsFromCtx(ctx)
+	if f == nil {
+		return Evaluation{Flag: name, Reason: ReasonNotFound}
+	}
+	return f.Evaluate(ctx, name)
+}
+
+// NewFlagsFx creates the Flags with the optional Store, sets them as the default, and refreshes them from the Store
+// while the app runs.
+func NewFlagsFx(deps struct {
+	fx.In
+
+	Conf      config.Config
+	Store     Store `optional:"true"`
+	Lifecycle fx.Lifecycle
+}) *Flags {
+	f := NewFlags(deps.Conf, deps.Store)
+	SetDefault(f)
+	deps.Lifecycle.Append(fx.StartStopHook(f.Start, f.Stop))
+	return f
+}
+
+// SubscribeToConfigChanges applies the flags config changes. It does nothing if no config.Watcher is provided.
+func SubscribeToConfigChanges(deps struct {
+	fx.In
+
+	Flags   *Flags
+	Watcher *config.Watcher `optional:"true"`
+	LF      *log.LoggerFactory
+}) {
+	if deps.Watcher == nil {
+		return
+	}
+	logger := deps.LF.GetLoggerForType(deps.Flags)
+	deps.Watcher.Subscribe(func(oldConf, newConf config.Config) {
+		if reflect.DeepEqual(oldConf.Flags.Definitions, newConf.Flags.Definitions) {
+			return
+		}
+		logger.Infof("Flags config changed, applying it")
+		deps.Flags.Update(newConf.Flags)
+	})
+}
+
+// Module provides the Flags. Add ModulePostgres, or provide a Store, to load flags without a deploy.
+var Module = fx.Options(
+	fx.Provide(NewFlagsFx),
+	fx.Invoke(SubscribeToConfigChanges),
+)
@@ -0,0 +1,146 @@
+package flags
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/di"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// Store loads flag definitions from outside the config, so they can be changed without a deploy.
+type Store interface {
+	// Load returns all the flag definitions by name.
+	Load(ctx context.Context) (map[string]config.FlagConfig, error)
+}
+
+/*
+PostgresStore stores the flag definitions in the feature_flag.flag table, as JSON with the fields of config.FlagConfig,
+like:
+
+	INSERT INTO feature_flag.flag (name, definition) VALUES ('new-checkout', '{"type": "percentage", "percentage": 10}');
+
+The schema and the table are created when the flags are loaded for the first time. It uses the database of the
+context, or the one it was created with.
+*/
+type PostgresStore struct {
+	db          database.DB
+	initialized atomic.Bool
+}
+
+var _ Store = &PostgresStore{}
+
+func NewPostgresStore(db database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+type flagRow struct {
+	Name       string
+	Definition []byte
+}
+
+func (s *PostgresStore) setCtx(ctx context.Context) context.Context {
+	if database.GetDBFromCtx(ctx) != nil || database.GetDBTxFromCtx(ctx) != nil {
+		return ctx
+	}
+	return s.db.SetCtx(ctx)
+}
+
+func (s *PostgresStore) setupDB(ctx context.Context) error {
+	if s.initialized.Load() {
+		return nil
+	}
+	err := database.InTx(ctx).Exec(`
+		CREATE SCHEMA IF NOT EXISTS feature_flag;
+		CREATE TABLE IF NOT EXISTS feature_flag.flag (
+			name TEXT PRIMARY KEY,
+			definition JSONB NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`).Error
+	if err == nil {
+		s.initialized.Store(true)
+		return nil
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) &&
+		(pgErr.ConstraintName == "pg_namespace_nspname_index" || pgErr.ConstraintName == "pg_type_typname_nsp_index") {
+		log.GetLoggerFromCtx(ctx).Debug("Another instance has already initialized the feature_flag schema")
+		s.initialized.Store(true)
+		return nil
+	}
+	return err
+}
+
+// Load returns the flag definitions stored in the table.
+func (s *PostgresStore) Load(ctx context.Context) (map[string]config.FlagConfig, error) {
+	ctx = s.setCtx(ctx)
+	if err := s.setupDB(ctx); err != nil {
+		return nil, errors.NewUnknownf("failed to setup the feature_flag schema, error: %w", err)
+	}
+
+	var rows []flagRow
+	err := database.InTx(ctx).Raw("SELECT name, definition FROM feature_flag.flag").Scan(&rows).Error
+	if err != nil {
+		return nil, errors.NewUnknownf("failed to load the flags, error: %w", err)
+	}
+
+	definitions := make(map[string]config.FlagConfig, len(rows))
+	for _, row := range rows {
+		var definition config.FlagConfig
+		if err = json.Unmarshal(row.Definition, &definition); err != nil {
+			return nil, errors.Newf(errors.ErrCodeBadState, "invalid definition of flag: %s, error: %w", row.Name, err)
+		}
+		if err = definition.Validate(); err != nil {
+			return nil, errors.Newf(errors.ErrCodeBadState, "invalid definition of flag: %s, error: %w", row.Name, err)
+		}
+		definitions[row.Name] = definition
+	}
+	return definitions, nil
+}
+
+// Set creates or replaces the definition of the flag. The running apps pick it up in their next refresh.
+func (s *PostgresStore) Set(ctx context.Context, name string, definition config.FlagConfig) error {
+	if err := definition.Validate(); err != nil {
+		return errors.Newf(errors.ErrCodeValidationFailed, "invalid definition of flag: %s, error: %w", name, err)
+	}
+	raw, err := json.Marshal(definition)
+	if err != nil {
+		return errors.NewUnknownf("failed to marshal the definition of flag: %s, error: %w", name, err)
+	}
+
+	ctx = s.setCtx(ctx)
+	if err = s.setupDB(ctx); err != nil {
+		return errors.NewUnknownf("failed to setup the feature_flag schema, error: %w", err)
+	}
+	err = database.InTx(ctx).Exec(
+		`INSERT INTO feature_flag.flag (name, definition) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET definition = EXCLUDED.definition, updated_at = now()`,
+		name,
+		string(raw),
+	).Error
+	if err != nil {
+		return errors.NewUnknownf("failed to set flag: %s, error: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes the definition of the flag, the config one is used again, if any.
+func (s *PostgresStore) Delete(ctx context.Context, name string) error {
+	ctx = s.setCtx(ctx)
+	if err := s.setupDB(ctx); err != nil {
+		return errors.NewUnknownf("failed to setup the feature_flag schema, error: %w", err)
+	}
+	if err := database.InTx(ctx).Exec("DELETE FROM feature_flag.flag WHERE name = ?", name).Error; err != nil {
+		return errors.NewUnknownf("failed to delete flag: %s, error: %w", name, err)
+	}
+	return nil
+}
+
+// ModulePostgres provides the PostgresStore as the Store of the Flags, it requires database.Module.
+var ModulePostgres = di.FxProvideAs[Store](NewPostgresStore, nil, nil)
@@ -0,0 +1,173 @@
+package flags_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	fwctx "github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/flags"
+	"github.com/southernlabs-io/go-fw/rest/middleware"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+type principal struct {
+	id string
+}
+
+func (p principal) GetID() any                        { return p.id }
+func (p principal) GetName() string                   { return p.id }
+func (p principal) GetEmail() string                  { return p.id + "@example.com" }
+func (p principal) GetType() middleware.PrincipalType { return "user" }
+
+func withPrincipal(ctx context.Context, id string) context.Context {
+	return fwctx.CtxSetValue(ctx, middleware.PrincipalCtxKey, principal{id: id})
+}
+
+// mapStore serves the flags from a map.
+type mapStore map[string]config.FlagConfig
+
+func (s mapStore) Load(context.Context) (map[string]config.FlagConfig, error) {
+	return s, nil
+}
+
+func TestFlags(t *testing.T) {
+	conf := config.Config{RootConfig: config.RootConfig{Env: config.EnvConfig{Name: "qa1", Type: config.EnvTypeSandbox}}}
+	conf.Flags.Definitions = map[string]config.FlagConfig{
+		"on":         {Enabled: true},
+		"off":        {Type: config.FlagTypeBoolean},
+		"prodOnly":   {Enabled: true, EnvTypes: []config.EnvType{config.EnvTypeProd}},
+		"sandbox":    {Enabled: true, EnvTypes: []config.EnvType{config.EnvTypeSandbox, config.EnvTypeProd}},
+		"enterprise": {Enabled: true, Attributes: map[string][]string{"plan": {"enterprise"}, flags.AttrEnvName: {"qa1"}}},
+		"all":        {Type: config.FlagTypePercentage, Percentage: 100},
+		"none":       {Type: config.FlagTypePercentage, Percentage: 0},
+		"half":       {Type: config.FlagTypePercentage, Percentage: 50},
+		"beta":       {Type: config.FlagTypeAllowList, Principals: []string{"alice"}},
+		"checkout":   {Type: config.FlagTypeVariant, Variants: map[string]float64{"blue": 25, "green": 25}},
+	}
+	f := flags.NewFlags(conf, nil)
+	ctx := context.Background()
+	alice := withPrincipal(ctx, "alice")
+
+	require.True(t, f.IsEnabled(ctx, "on"))
+	require.False(t, f.IsEnabled(ctx, "off"))
+	require.Equal(t, flags.Evaluation{Flag: "unknown", Reason: flags.ReasonNotFound}, f.Evaluate(ctx, "unknown"))
+	require.Equal(t, flags.Evaluation{Flag: "prodOnly", Reason: flags.ReasonEnvType}, f.Evaluate(ctx, "prodOnly"))
+	require.True(t, f.IsEnabled(ctx, "sandbox"))
+
+	require.Equal(t, flags.ReasonAttributes, f.Evaluate(ctx, "enterprise").Reason)
+	require.False(t, f.IsEnabled(flags.WithAttributes(ctx, map[string]string{"plan": "free"}), "enterprise"))
+	require.True(t, f.IsEnabled(flags.WithAttributes(ctx, map[string]string{"plan": "enterprise"}), "enterprise"))
+
+	require.True(t, f.IsEnabled(ctx, "all"))
+	require.False(t, f.IsEnabled(alice, "none"))
+	require.Equal(t, flags.Evaluation{Flag: "half", Reason: flags.ReasonPrincipal}, f.Evaluate(ctx, "half"))
+
+	require.True(t, f.IsEnabled(alice, "beta"))
+	require.False(t, f.IsEnabled(withPrincipal(ctx, "bob"), "beta"))
+	require.False(t, f.IsEnabled(ctx, "beta"))
+
+	// Percentages and variants are stable per principal, and close to the configured weights
+	enabled := 0
+	variants := make(map[string]int)
+	for i := range 10_000 {
+		principalCtx := withPrincipal(ctx, fmt.Sprint("principal-", i))
+		if f.IsEnabled(principalCtx, "half") {
+			enabled++
+		}
+		require.Equal(t, f.IsEnabled(principalCtx, "half"), f.IsEnabled(principalCtx, "half"))
+		variant := f.Variant(principalCtx, "checkout")
+		require.Equal(t, variant != "", f.IsEnabled(principalCtx, "checkout"))
+		variants[variant]++
+	}
+	require.InDelta(t, 5_000, enabled, 300)
+	require.InDelta(t, 2_500, variants["blue"], 300)
+	require.InDelta(t, 2_500, variants["green"], 300)
+	require.InDelta(t, 5_000, variants[""], 300)
+
+	// The store overrides the config
+	f = flags.NewFlags(conf, mapStore{"off": {Enabled: true}})
+	require.False(t, f.IsEnabled(ctx, "off"))
+	require.NoError(t, f.Refresh(ctx))
+	require.True(t, f.IsEnabled(ctx, "off"))
+	require.True(t, f.IsEnabled(ctx, "on"))
+
+	// Config updates keep the store flags
+	f.Update(config.FlagsConfig{Definitions: map[string]config.FlagConfig{"off": {}, "new": {Enabled: true}}})
+	require.True(t, f.IsEnabled(ctx, "off"))
+	require.True(t, f.IsEnabled(ctx, "new"))
+	require.False(t, f.IsEnabled(ctx, "on"))
+}
+
+func TestFlagConfigValidate(t *testing.T) {
+	require.NoError(t, config.FlagConfig{}.Validate())
+	require.Error(t, config.FlagConfig{Type: "unknown"}.Validate())
+	require.Error(t, config.FlagConfig{Type: config.FlagTypeVariant}.Validate())
+	require.Error(t, config.FlagConfig{
+		Type:     config.FlagTypeVariant,
+		Variants: map[string]float64{"a": 60, "b": 60},
+	}.Validate())
+	require.Error(t, config.Validate(config.FlagConfig{Percentage: 101}))
+}
+
+func TestModule(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+flags:
+  definitions:
+    newCheckout:
+      type: allowList
+      principals: [alice]
+    darkMode:
+      enabled: true
+      attributes:
+        principalType: [user]
+`), 0o600))
+	t.Setenv(config.ConfigFileEnvVar, configFile)
+
+	var ctx context.Context
+	var f *flags.Flags
+	test.FxUnit(t, flags.Module).Populate(&ctx, &f)
+	require.Same(t, f, flags.GetFlagsFromCtx(ctx))
+
+	alice := withPrincipal(ctx, "alice")
+	require.True(t, flags.IsEnabled(alice, "newCheckout"))
+	require.False(t, flags.IsEnabled(withPrincipal(ctx, "bob"), "newCheckout"))
+	require.True(t, flags.IsEnabled(alice, "darkMode"))
+	require.False(t, flags.IsEnabled(ctx, "darkMode"))
+
+	// The flags of the context are used before the default ones
+	other := flags.NewFlags(config.Config{}, nil)
+	require.False(t, flags.IsEnabled(other.SetCtx(alice), "newCheckout"))
+}
+
+func TestPostgresStore(t *testing.T) {
+	var ctx context.Context
+	var store flags.Store
+	var f *flags.Flags
+	test.FxIntegrationWithDB(t, flags.ModulePostgres, flags.Module).Populate(&ctx, &store, &f)
+
+	name := "flag-" + uuid.NewString()
+	require.False(t, f.IsEnabled(ctx, name))
+
+	pgStore := store.(*flags.PostgresStore)
+	require.Error(t, pgStore.Set(ctx, name, config.FlagConfig{Type: "unknown"}))
+	require.NoError(t, pgStore.Set(ctx, name, config.FlagConfig{Type: config.FlagTypePercentage, Percentage: 100}))
+	require.NoError(t, f.Refresh(ctx))
+	require.True(t, f.IsEnabled(ctx, name))
+
+	definitions, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, config.FlagConfig{Type: config.FlagTypePercentage, Percentage: 100}, definitions[name])
+
+	require.NoError(t, pgStore.Delete(ctx, name))
+	require.NoError(t, f.Refresh(ctx))
+	require.False(t, f.IsEnabled(ctx, name))
+}
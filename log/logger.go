@@ -259,4 +259,7 @@ func (l Logger) logAttrs(logTime time.Time, level config.LogLevel, skipCallers i
 	_ = l.h.Handle(l.ctx, r)
 }
 
-var Module = fx.Provide(NewLoggerFactory)
+var Module = fx.Options(
+	fx.Provide(NewLoggerFactory),
+	fx.Invoke(SubscribeToConfigChanges),
+)
@@ -9,6 +9,8 @@ import (
 	"runtime"
 	"strings"
 
+	"go.uber.org/fx"
+
 	"github.com/southernlabs-io/go-fw/config"
 	"github.com/southernlabs-io/go-fw/context"
 	"github.com/southernlabs-io/go-fw/errors"
@@ -35,16 +37,13 @@ type ValueContext interface{ Value(any) any }
 type LoggerFactory struct {
 	loggersByPath *sync.Map[string, Logger]
 	coreConfig    config.RootConfig
+	coreConfigMu  sync.RWMutex
 	writer        io.Writer
 }
 
 // NewLoggerFactory creates a new logger factory with the given core configuration.
 func NewLoggerFactory(coreConfig config.RootConfig) *LoggerFactory {
-	normalized := make(map[string]config.LogLevel, len(coreConfig.Log.Levels))
-	for pth, level := range coreConfig.Log.Levels {
-		normalized[path.Clean(pth)] = level
-	}
-	coreConfig.Log.Levels = normalized
+	coreConfig.Log.Levels = normalizeLevels(coreConfig.Log.Levels)
 
 	return &LoggerFactory{
 		loggersByPath: sync.NewMap[string, Logger](),
@@ -52,6 +51,47 @@ func NewLoggerFactory(coreConfig config.RootConfig) *LoggerFactory {
 	}
 }
 
+func normalizeLevels(levels map[string]config.LogLevel) map[string]config.LogLevel {
+	normalized := make(map[string]config.LogLevel, len(levels))
+	for pth, level := range levels {
+		normalized[path.Clean(pth)] = level
+	}
+	return normalized
+}
+
+// UpdateLogLevels updates Log.Level and Log.Levels, and applies them to all the loggers already created by this
+// factory. Other Log settings, like the Writer, are not updated.
+func (lf *LoggerFactory) UpdateLogLevels(logConf config.LogConfig) {
+	lf.coreConfigMu.Lock()
+	lf.coreConfig.Log.Level = logConf.Level
+	lf.coreConfig.Log.Levels = normalizeLevels(logConf.Levels)
+	lf.coreConfigMu.Unlock()
+
+	lf.loggersByPath.Range(func(pth string, logger Logger) bool {
+		logger.SetLevel(lf.levelForPath(pth))
+		return true
+	})
+}
+
+// SubscribeToConfigChanges updates the log levels of the LoggerFactory, and of the default one, when the config
+// changes. It does nothing if no config.Watcher is provided.
+func SubscribeToConfigChanges(deps struct {
+	fx.In
+
+	LF      *LoggerFactory
+	Watcher *config.Watcher `optional:"true"`
+}) {
+	if deps.Watcher == nil {
+		return
+	}
+	deps.Watcher.Subscribe(func(_, newConf config.Config) {
+		deps.LF.UpdateLogLevels(newConf.Log)
+		if defaultLf := GetDefaultLoggerFactory(); defaultLf != deps.LF {
+			defaultLf.UpdateLogLevels(newConf.Log)
+		}
+	})
+}
+
 // NewLoggerFactoryWithWriter creates a new logger factory with the given core configuration and writer.
 func NewLoggerFactoryWithWriter(coreConfig config.RootConfig, writer io.Writer) *LoggerFactory {
 	factory := NewLoggerFactory(coreConfig)
@@ -212,11 +252,15 @@ func GetLoggerFromCtxForPath(ctx ValueContext, pth string) Logger {
 
 // newLogger creates a new logger for the given path and sets the level based on the configuration.
 func (lf *LoggerFactory) newLogger(pth string) Logger {
+	lf.coreConfigMu.RLock()
+	coreConfig := lf.coreConfig
+	lf.coreConfigMu.RUnlock()
+
 	var writer io.Writer
 	if lf.writer != nil {
 		writer = lf.writer
 	} else {
-		switch lf.coreConfig.Log.Writer {
+		switch coreConfig.Log.Writer {
 		case "", config.LogConfigWriterStdout:
 			writer = os.Stdout
 		case config.LogConfigWriterStderr:
@@ -224,18 +268,23 @@ func (lf *LoggerFactory) newLogger(pth string) Logger {
 		case config.LogConfigWriterBuffer:
 			writer = new(bytes.Buffer)
 		default:
-			panic(errors.Newf(errors.ErrCodeBadArgument, "unknown log writer: %s", lf.coreConfig.Log.Writer))
+			panic(errors.Newf(errors.ErrCodeBadArgument, "unknown log writer: %s", coreConfig.Log.Writer))
 		}
 	}
-	logger := NewLoggerWithWriter(lf.coreConfig, pth, writer)
+	logger := NewLoggerWithWriter(coreConfig, pth, writer)
+	logger.SetLevel(lf.levelForPath(pth))
+	return logger
+}
 
-	// Check if there is a configured level for this path
+// levelForPath returns the configured level for the longest matching path prefix, or Log.Level if there is none.
+func (lf *LoggerFactory) levelForPath(pth string) config.LogLevel {
+	lf.coreConfigMu.RLock()
+	defer lf.coreConfigMu.RUnlock()
 	for idx := len(pth); idx > 0; idx = strings.LastIndexAny(pth, "/.") {
 		pth = pth[:idx]
 		if level, present := lf.coreConfig.Log.Levels[pth]; present {
-			logger.SetLevel(level)
-			break
+			return level
 		}
 	}
-	return logger
+	return lf.coreConfig.Log.Level
 }
@@ -223,3 +223,25 @@ func TestContext(t *testing.T) {
 	require.Contains(t, msg, "duration")
 	require.Equal(t, float64(time.Second.Milliseconds()), msg["duration"])
 }
+
+func TestUpdateLogLevels(t *testing.T) {
+	lf := log.NewLoggerFactory(config.RootConfig{
+		Log: config.LogConfig{
+			Level: config.LogLevelInfo,
+		},
+	})
+	logger := lf.GetLoggerForPath("my-local-package/math")
+	otherLogger := lf.GetLoggerForPath("other-package")
+	require.Equal(t, config.LogLevelInfo, logger.Level())
+	require.Equal(t, config.LogLevelInfo, otherLogger.Level())
+
+	lf.UpdateLogLevels(config.LogConfig{
+		Level: config.LogLevelWarn,
+		Levels: map[string]config.LogLevel{
+			"my-local-package/": config.LogLevelTrace,
+		},
+	})
+	require.Equal(t, config.LogLevelTrace, logger.Level())
+	require.Equal(t, config.LogLevelWarn, otherLogger.Level())
+	require.Equal(t, config.LogLevelTrace, lf.GetLoggerForPath("my-local-package").Level())
+}
@@ -0,0 +1,138 @@
+/*
+Package outbox publishes messages reliably from inside database transactions, with the transactional outbox pattern.
+
+Enqueue writes the message to the outbox.message table in the transaction of the context, so it is only published if
+the transaction commits:
+
+	tx, ctx := database.WithTx(ctx)
+	defer tx.DeferredCommitOrRollback(&err)
+	if err = database.InTx(ctx).Create(&order).Error; err != nil {
+		return err
+	}
+	return outbox.EnqueueWithKey(ctx, "order.created", order.CustomerID, OrderCreated{ID: order.ID})
+
+The Relay, a worker.LongRunningWorker, publishes the pending messages with the Publisher of the app, see Module.
+*/
+package outbox
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// Message is a message of the outbox.
+type Message struct {
+	ID    int64
+	Topic string
+	// Key orders the messages, the ones with the same key are published in the order they were enqueued. It is empty
+	// for the messages enqueued without a key, which are not ordered.
+	Key     string
+	Payload json.RawMessage
+	// Attempts is the number of times it was published before, and failed.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Publisher publishes the messages of the outbox, like to a message broker.
+type Publisher interface {
+	// Publish publishes the message. It is retried if it returns an error, so a message can be published more than
+	// once, and the consumers must be idempotent, like by using Message.ID.
+	Publish(ctx context.Context, msg Message) error
+}
+
+// schemaRaceConstraints are violated when another instance creates the schema at the same time.
+var schemaRaceConstraints = []string{
+	"pg_namespace_nspname_index",
+	"pg_type_typname_nsp_index",
+	"pg_class_relname_nsp_index",
+}
+
+// initializedDBs are the databases where the schema was created, by their dialector, which is shared by all their
+// sessions and transactions.
+var initializedDBs sync.Map
+
+// setupDB creates the schema, in a sub transaction, so a failure doesn't abort the transaction of the context.
+func setupDB(ctx context.Context) (err error) {
+	dialector := database.InTx(ctx).Dialector
+	if _, found := initializedDBs.Load(dialector); found {
+		return nil
+	}
+	tx, _ := database.WithTx(ctx)
+	err = tx.Exec(`
+		CREATE SCHEMA IF NOT EXISTS outbox;
+		CREATE TABLE IF NOT EXISTS outbox.message (
+			id BIGSERIAL PRIMARY KEY,
+			topic TEXT NOT NULL,
+			key TEXT NOT NULL DEFAULT '',
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			last_error TEXT,
+			delivered_at TIMESTAMP WITH TIME ZONE,
+			failed_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS message_pending_idx ON outbox.message (key, id)
+			WHERE delivered_at IS NULL AND failed_at IS NULL;
+		CREATE INDEX IF NOT EXISTS message_delivered_at_idx ON outbox.message (delivered_at)
+			WHERE delivered_at IS NOT NULL`).Error
+	if err != nil {
+		_ = tx.Rollback()
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || !slices.Contains(schemaRaceConstraints, pgErr.ConstraintName) {
+			return errors.NewUnknownf("failed to setup the outbox schema, error: %w", err)
+		}
+		log.GetLoggerFromCtx(ctx).Debug("Another instance has already initialized the outbox schema")
+	} else if err = tx.Commit().Error; err != nil {
+		return errors.NewUnknownf("failed to setup the outbox schema, error: %w", err)
+	}
+	// Inside another transaction, the schema exists once it commits
+	if parentTx := database.GetDBTxFromCtx(ctx); parentTx != nil && !parentTx.IsClosed() {
+		parentTx.AfterCommit(func(context.Context) { initializedDBs.Store(dialector, true) })
+	} else {
+		initializedDBs.Store(dialector, true)
+	}
+	return nil
+}
+
+// Enqueue writes a message to the outbox in the transaction of the context, see EnqueueWithKey.
+func Enqueue(ctx context.Context, topic string, payload any) error {
+	return EnqueueWithKey(ctx, topic, "", payload)
+}
+
+// EnqueueWithKey writes a message to the outbox in the transaction of the context, so the Relay publishes it only if
+// the transaction commits. The payload is marshalled to JSON. The messages with the same key are published in the order
+// they were enqueued.
+func EnqueueWithKey(ctx context.Context, topic string, key string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Newf(
+			errors.ErrCodeBadArgument,
+			"failed to marshal the payload of topic: %s, error: %w",
+			topic,
+			err,
+		)
+	}
+	if err = setupDB(ctx); err != nil {
+		return err
+	}
+	err = database.InTx(ctx).Exec(
+		"INSERT INTO outbox.message (topic, key, payload) VALUES (?, ?, ?)",
+		topic,
+		key,
+		string(raw),
+	).Error
+	if err != nil {
+		return errors.NewUnknownf("failed to enqueue message of topic: %s, error: %w", topic, err)
+	}
+	return nil
+}
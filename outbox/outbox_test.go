@@ -0,0 +1,94 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/outbox"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+type event struct {
+	Name string
+}
+
+// recordingPublisher records the published messages, and fails the ones of the failing events.
+type recordingPublisher struct {
+	published []string
+	failing   map[string]bool
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, msg outbox.Message) error {
+	var e event
+	if err := json.Unmarshal(msg.Payload, &e); err != nil {
+		return err
+	}
+	if p.failing[e.Name] {
+		return errors.NewUnknownf("failed to publish: %s", e.Name)
+	}
+	p.published = append(p.published, e.Name)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	var ctx context.Context
+	var conf config.Config
+	test.FxIntegration(t).WithDB().Populate(&ctx, &conf)
+
+	enqueue := func(ctx context.Context, key string, names ...string) {
+		for _, name := range names {
+			require.NoError(t, outbox.EnqueueWithKey(ctx, "test", key, event{Name: name}))
+		}
+	}
+	tx, txCtx := database.WithTx(ctx)
+	enqueue(txCtx, "a", "a1", "a2")
+	enqueue(txCtx, "b", "b1", "b2")
+	require.NoError(t, outbox.Enqueue(txCtx, "test", event{Name: "c1"}))
+	require.NoError(t, tx.Commit().Error)
+	tx, txCtx = database.WithTx(ctx)
+	enqueue(txCtx, "a", "rolled back")
+	require.NoError(t, tx.Rollback().Error)
+
+	conf.Outbox.MaxAttempts = 2
+	conf.Outbox.RetryBackoff = 0
+	publisher := &recordingPublisher{failing: map[string]bool{"a1": true}}
+	relay := outbox.NewRelay(conf, publisher)
+
+	// a2 waits for a1
+	published, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, published)
+	require.Equal(t, []string{"b1", "b2", "c1"}, publisher.published)
+
+	// a1 fails again, and is given up, so a2 is published
+	publisher.published = nil
+	published, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+	published, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+	require.Equal(t, []string{"a2"}, publisher.published)
+
+	var failed []string
+	require.NoError(t, database.InTx(ctx).
+		Raw("SELECT payload->>'Name' FROM outbox.message WHERE failed_at IS NOT NULL").
+		Scan(&failed).Error)
+	require.Equal(t, []string{"a1"}, failed)
+
+	conf.Outbox.Retention = 0
+	deleted, err := outbox.NewRelay(conf, publisher).Cleanup(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, deleted)
+}
+
+func TestEnqueueInvalidPayload(t *testing.T) {
+	err := outbox.Enqueue(context.Background(), "test", func() {})
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadArgument))
+}
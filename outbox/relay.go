@@ -0,0 +1,229 @@
+package outbox
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/sync"
+	"github.com/southernlabs-io/go-fw/worker"
+)
+
+// cleanupInterval is how often the delivered messages older than config.OutboxConfig.Retention are deleted.
+const cleanupInterval = time.Minute
+
+// pendingMessagesSQL selects the messages that are due, skipping the ones with a key that has an earlier message which
+// is not, so they are published in order.
+const pendingMessagesSQL = `
+	SELECT id, topic, key, payload, attempts, created_at FROM outbox.message m
+	WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+	  AND (key = '' OR NOT EXISTS (
+		SELECT 1 FROM outbox.message p
+		WHERE p.key = m.key AND p.id < m.id AND p.delivered_at IS NULL AND p.failed_at IS NULL
+		  AND p.next_attempt_at > now()
+	  ))
+	ORDER BY id
+	LIMIT ?`
+
+/*
+Relay publishes the pending messages of the outbox with the Publisher, in the order they were enqueued. It runs in one
+instance of the app at a time, see worker.ConcurrencyModeSingle.
+
+A message that fails to publish is retried with an exponential backoff, and the later messages with its key wait for it.
+After config.OutboxConfig.MaxAttempts it is marked as failed, and kept in the table, so the next ones are published. The
+delivered messages are deleted after config.OutboxConfig.Retention.
+*/
+type Relay struct {
+	conf      config.OutboxConfig
+	id        string
+	publisher Publisher
+}
+
+var _ worker.LongRunningWorker = &Relay{}
+
+func NewRelay(conf config.Config, publisher Publisher) *Relay {
+	return &Relay{
+		conf:      conf.Outbox,
+		id:        uuid.NewString(),
+		publisher: publisher,
+	}
+}
+
+func (r *Relay) GetName() string {
+	return "outbox-relay"
+}
+
+func (r *Relay) GetID() string {
+	return r.id
+}
+
+func (r *Relay) GetConcurrency() worker.ConcurrencyConfig {
+	return worker.ConcurrencyConfig{Mode: worker.ConcurrencyModeSingle, SingleLockTTL: r.conf.LockTTL}
+}
+
+// Run publishes the pending messages until the context is done.
+func (r *Relay) Run(ctx context.Context) error {
+	logger := log.GetLoggerFromCtx(ctx)
+	if err := setupDB(ctx); err != nil {
+		return err
+	}
+	var lastCleanup time.Time
+	for {
+		if time.Since(lastCleanup) >= cleanupInterval {
+			if deleted, err := r.Cleanup(ctx); err != nil {
+				logger.Errorf("Failed to clean up the outbox: %s", err)
+			} else {
+				lastCleanup = time.Now()
+				if deleted > 0 {
+					logger.Debugf("Deleted delivered outbox messages: %d", deleted)
+				}
+			}
+		}
+
+		published, err := r.RelayBatch(ctx)
+		if err != nil {
+			logger.Errorf("Failed to relay the outbox: %s", err)
+		}
+		// Keep going while there are more messages
+		if err == nil && published == r.conf.BatchSize {
+			if err = context.Cause(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = sync.Sleep(ctx, r.conf.PollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// RelayBatch publishes up to config.OutboxConfig.BatchSize pending messages, and returns how many were published.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	var messages []Message
+	err := database.InTx(ctx).Raw(pendingMessagesSQL, r.conf.BatchSize).Scan(&messages).Error
+	if err != nil {
+		return 0, errors.NewUnknownf("failed to load the pending messages, error: %w", err)
+	}
+
+	logger := log.GetLoggerFromCtx(ctx)
+	published := 0
+	// The keys with a message that failed in this batch, so the next ones wait for it
+	failedKeys := make(map[string]bool)
+	for _, msg := range messages {
+		if msg.Key != "" && failedKeys[msg.Key] {
+			continue
+		}
+		if err = context.Cause(ctx); err != nil {
+			return published, err
+		}
+		publishErr := r.publish(ctx, msg)
+		if publishErr == nil {
+			err = database.InTx(ctx).Exec(
+				"UPDATE outbox.message SET delivered_at = now(), attempts = attempts + 1 WHERE id = ?",
+				msg.ID,
+			).Error
+			if err != nil {
+				return published, errors.NewUnknownf("failed to mark message: %d as delivered, error: %w", msg.ID, err)
+			}
+			published++
+			continue
+		}
+
+		failedKeys[msg.Key] = true
+		attempts := msg.Attempts + 1
+		if r.conf.MaxAttempts > 0 && attempts >= r.conf.MaxAttempts {
+			logger.Errorf(
+				"Outbox message: %d of topic: %s failed after: %d attempts, giving up, error: %s",
+				msg.ID,
+				msg.Topic,
+				attempts,
+				publishErr,
+			)
+			err = database.InTx(ctx).Exec(
+				"UPDATE outbox.message SET failed_at = now(), attempts = ?, last_error = ? WHERE id = ?",
+				attempts,
+				publishErr.Error(),
+				msg.ID,
+			).Error
+		} else {
+			backoff := r.retryBackoff(attempts)
+			logger.Warnf(
+				"Outbox message: %d of topic: %s failed, attempt: %d, retrying in: %s, error: %s",
+				msg.ID,
+				msg.Topic,
+				attempts,
+				backoff,
+				publishErr,
+			)
+			err = database.InTx(ctx).Exec(
+				`UPDATE outbox.message
+					SET attempts = ?, last_error = ?, next_attempt_at = now() + INTERVAL '1 millisecond' * ?
+					WHERE id = ?`,
+				attempts,
+				publishErr.Error(),
+				backoff.Milliseconds(),
+				msg.ID,
+			).Error
+		}
+		if err != nil {
+			return published, errors.NewUnknownf("failed to update message: %d, error: %w", msg.ID, err)
+		}
+	}
+	return published, nil
+}
+
+func (r *Relay) publish(ctx context.Context, msg Message) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.Newf(errors.ErrCodePanic, "panic publishing message: %d, error: %v", msg.ID, recovered)
+		}
+	}()
+	return r.publisher.Publish(ctx, msg)
+}
+
+// retryBackoff returns the delay before the next attempt: config.OutboxConfig.RetryBackoff doubled on every attempt, up
+// to config.OutboxConfig.RetryMaxBackoff, if it isn't 0.
+func (r *Relay) retryBackoff(attempts int) time.Duration {
+	maxBackoff := r.conf.RetryMaxBackoff
+	if maxBackoff <= 0 {
+		// Doubling it again would overflow
+		maxBackoff = math.MaxInt64 / 2
+	}
+	backoff := r.conf.RetryBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// Cleanup deletes the messages delivered more than config.OutboxConfig.Retention ago, and returns how many.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	result := database.InTx(ctx).Exec(
+		"DELETE FROM outbox.message WHERE delivered_at <= now() - INTERVAL '1 millisecond' * ?",
+		r.conf.Retention.Milliseconds(),
+	)
+	if result.Error != nil {
+		return 0, errors.NewUnknownf("failed to delete the delivered messages, error: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+/*
+Module runs the Relay in the worker.LongRunningWorkerHandler. It requires the Publisher of the app, a
+distributedlock.Factory, like distributedlock.ModulePostgres, and database.Module:
+
+	fx.Options(
+		database.Module,
+		distributedlock.ModulePostgres,
+		worker.ModuleWorkerHandler,
+		di.FxProvideAs[outbox.Publisher](NewSNSPublisher, nil, nil),
+		outbox.Module,
+	)
+*/
+var Module = worker.ProvideAsLongRunningWorker(NewRelay)
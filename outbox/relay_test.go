@@ -0,0 +1,22 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	relay := &Relay{conf: config.OutboxConfig{RetryBackoff: time.Second, RetryMaxBackoff: 5 * time.Second}}
+	require.Equal(t, time.Second, relay.retryBackoff(1))
+	require.Equal(t, 4*time.Second, relay.retryBackoff(3))
+	require.Equal(t, 5*time.Second, relay.retryBackoff(10))
+
+	// 0 means no limit
+	relay.conf.RetryMaxBackoff = 0
+	require.Equal(t, 8*time.Second, relay.retryBackoff(4))
+	require.Positive(t, relay.retryBackoff(1000))
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"reflect"
+	"sync/atomic"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,11 +24,34 @@ type HTTPHandler struct {
 	BasePath string
 }
 
+type HTTPHandlerParams struct {
+	fx.In
+
+	Conf      config.Config
+	LF        *log.LoggerFactory
+	Lifecycle fx.Lifecycle
+	Watcher   *config.Watcher `optional:"true"`
+}
+
+// NewHTTPHandlerFx creates a new request handler. If a config.Watcher is provided, CORS changes are applied live.
+func NewHTTPHandlerFx(params HTTPHandlerParams) HTTPHandler {
+	return newHTTPHandler(params.Conf, params.LF, params.Lifecycle, params.Watcher)
+}
+
 // NewHTTPHandler creates a new request handler
 func NewHTTPHandler(
 	conf config.Config,
 	lf *log.LoggerFactory,
 	lc fx.Lifecycle,
+) HTTPHandler {
+	return newHTTPHandler(conf, lf, lc, nil)
+}
+
+func newHTTPHandler(
+	conf config.Config,
+	lf *log.LoggerFactory,
+	lc fx.Lifecycle,
+	watcher *config.Watcher,
 ) HTTPHandler {
 	logger := lf.GetLoggerForType(HTTPHandler{})
 	ginLogger := lf.GetLoggerForType(gin.Engine{})
@@ -40,9 +65,25 @@ func NewHTTPHandler(
 	engine := gin.New()
 	engine.ContextWithFallback = true
 
+	corsHandler := &atomic.Pointer[gin.HandlerFunc]{}
+	newCORSHandler := cors.New(conf.HttpServer.CORS.Config)
+	corsHandler.Store(&newCORSHandler)
+	if watcher != nil {
+		watcher.Subscribe(func(oldConf, newConf config.Config) {
+			if reflect.DeepEqual(oldConf.HttpServer.CORS, newConf.HttpServer.CORS) {
+				return
+			}
+			logger.Infof("CORS config changed, applying it")
+			newCORSHandler := cors.New(newConf.HttpServer.CORS.Config)
+			corsHandler.Store(&newCORSHandler)
+		})
+	}
+
 	modules := []gin.HandlerFunc{
 		// CORS
-		cors.New(conf.HttpServer.CORS.Config),
+		func(ctx *gin.Context) {
+			(*corsHandler.Load())(ctx)
+		},
 	}
 
 	if conf.Datadog.Tracing {
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
 	"github.com/southernlabs-io/go-fw/errors"
 	"github.com/southernlabs-io/go-fw/log"
 	"github.com/southernlabs-io/go-fw/rest"
@@ -18,7 +19,7 @@ import (
 
 var ErrInvalidToken = errors.Newf("AUTHN_TOKEN_NOT_VALID", "token is not valid")
 
-const PrincipalCtxKey = "authn_principal"
+const PrincipalCtxKey = context.PrincipalCtxKey
 const AuthNExcludedCtxKey = "authn_excluded"
 
 type PrincipalType string
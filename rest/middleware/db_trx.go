@@ -11,6 +11,9 @@ import (
 	"github.com/southernlabs-io/go-fw/rest"
 )
 
+// DatabaseTrxMiddleware sets the DB in the context of the request. The transactions of the request that are left open,
+// by a panic or by mistake, are rolled back, which runs their database.DBTx.AfterRollback hooks and drops the
+// AfterCommit ones.
 type DatabaseTrxMiddleware struct {
 	BaseMiddleware
 	db database.DB
@@ -199,6 +199,7 @@ var errorCodesToStatus = map[string]int{
 	errors.ErrCodeConflict:         http.StatusConflict,
 	errors.ErrCodeBadArgument:      http.StatusUnprocessableEntity,
 	errors.ErrCodeValidationFailed: http.StatusUnprocessableEntity,
+	errors.ErrCodeTimeout:          http.StatusGatewayTimeout,
 }
 
 func defaultHandler(ctx *gin.Context, envType config.EnvType, body any, shouldWrite bool) int {
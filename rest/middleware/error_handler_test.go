@@ -140,6 +140,13 @@ func TestErrorHandler(t *testing.T) {
 	ginCtx.Writer.Flush()
 	require.EqualValues(t, http.StatusUnauthorized, w.Code)
 
+	// Test default handler ErrCodeTimeout
+	w, ginCtx = setupGinTest()
+	_ = ginCtx.Error(errors.Newf(errors.ErrCodeTimeout, "timeout"))
+	errorHandler.Run(ginCtx)
+	ginCtx.Writer.Flush()
+	require.EqualValues(t, http.StatusGatewayTimeout, w.Code)
+
 	// Test default handler ErrCodePanic
 	w, ginCtx = setupGinTest()
 	_ = ginCtx.Error(errors.Newf(errors.ErrCodePanic, "panic"))
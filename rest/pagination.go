@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/southernlabs-io/go-fw/database/pagination"
+)
+
+// PageResponse is the envelope of the responses with a page of items.
+type PageResponse[T any] struct {
+	Data  []T       `json:"data"`
+	Links PageLinks `json:"links"`
+}
+
+// PageLinks are the links to the pages next to the current one, they are empty when there is no such page.
+type PageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// BindPage binds the page[size], page[after] and page[before] query parameters to a pagination.Page, with
+// BindDeepObjectQuery. It will abort with error http.StatusBadRequest if the binding fails.
+func BindPage(ctx *gin.Context) (pagination.Page, error) {
+	var query struct {
+		Page pagination.Page
+	}
+	err := BindDeepObjectQuery(ctx, &query)
+	return query.Page, err
+}
+
+// NewPageResponse returns the envelope of the page. The links are the URL of the request, with the page[after] or
+// page[before] query parameter set to the cursor of the page, so they keep the size and the other parameters.
+func NewPageResponse[T any](ctx *gin.Context, result pagination.Result[T]) PageResponse[T] {
+	data := result.Items
+	if data == nil {
+		data = []T{}
+	}
+	return PageResponse[T]{
+		Data: data,
+		Links: PageLinks{
+			Next: pageLink(ctx, "page[after]", result.Next),
+			Prev: pageLink(ctx, "page[before]", result.Prev),
+		},
+	}
+}
+
+func pageLink(ctx *gin.Context, param string, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	query := ctx.Request.URL.Query()
+	query.Del("page[after]")
+	query.Del("page[before]")
+	query.Set(param, cursor)
+	return ctx.Request.URL.Path + "?" + query.Encode()
+}
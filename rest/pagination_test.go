@@ -0,0 +1,39 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/database/pagination"
+	"github.com/southernlabs-io/go-fw/rest"
+)
+
+func TestBindPage(t *testing.T) {
+	pageURL, err := url.ParseRequestURI("/items?filter[name]=john&page[size]=10&page[after]=abc")
+	require.NoError(t, err)
+
+	page, err := rest.BindPage(&gin.Context{Request: &http.Request{URL: pageURL}})
+	require.NoError(t, err)
+	require.Equal(t, pagination.Page{Size: 10, After: "abc"}, page)
+}
+
+func TestNewPageResponse(t *testing.T) {
+	pageURL, err := url.ParseRequestURI("/items?filter[name]=john&page[size]=10&page[after]=abc")
+	require.NoError(t, err)
+	ctx := &gin.Context{Request: &http.Request{URL: pageURL}}
+
+	response := rest.NewPageResponse(ctx, pagination.Result[int]{Items: []int{1, 2}, Next: "next", Prev: "prev"})
+	require.Equal(t, []int{1, 2}, response.Data)
+	require.Equal(t, rest.PageLinks{
+		Next: "/items?filter%5Bname%5D=john&page%5Bafter%5D=next&page%5Bsize%5D=10",
+		Prev: "/items?filter%5Bname%5D=john&page%5Bbefore%5D=prev&page%5Bsize%5D=10",
+	}, response.Links)
+
+	response = rest.NewPageResponse(ctx, pagination.Result[int]{})
+	require.Equal(t, []int{}, response.Data)
+	require.Equal(t, rest.PageLinks{}, response.Links)
+}
@@ -1,7 +1,9 @@
 package providers
 
 import (
+	"github.com/southernlabs-io/go-fw/config"
 	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/log"
 	"github.com/southernlabs-io/go-fw/rest/middleware"
 )
 
@@ -26,3 +28,41 @@ func (p DatabaseHealthCheckProvider) GetName() string {
 func (p DatabaseHealthCheckProvider) HealthCheck() error {
 	return p.db.HealthCheck()
 }
+
+// DatabaseReplicasHealthCheckProvider reports the lag or error of every read replica when none is healthy. It only logs
+// them, as the reads fall back to the primary, unless config.DatabaseConfig.ReplicasRequired, then it fails.
+type DatabaseReplicasHealthCheckProvider struct {
+	replicas *database.Replicas
+	required bool
+	logger   log.Logger
+}
+
+var _ middleware.HealthCheckProvider = new(DatabaseReplicasHealthCheckProvider)
+
+func NewDatabaseReplicasHealthCheckProvider(
+	db database.DB,
+	conf config.Config,
+	lf *log.LoggerFactory,
+) *DatabaseReplicasHealthCheckProvider {
+	if db.DB == nil || db.Replicas() == nil {
+		return nil
+	}
+	return &DatabaseReplicasHealthCheckProvider{
+		db.Replicas(),
+		conf.Database.ReplicasRequired,
+		lf.GetLoggerForType(DatabaseReplicasHealthCheckProvider{}),
+	}
+}
+
+func (p DatabaseReplicasHealthCheckProvider) GetName() string {
+	return "DB replicas"
+}
+
+func (p DatabaseReplicasHealthCheckProvider) HealthCheck() error {
+	err := p.replicas.HealthCheck()
+	if err != nil && !p.required {
+		p.logger.Warnf("Reads fall back to the primary: %s", err)
+		return nil
+	}
+	return err
+}
@@ -36,6 +36,10 @@ var Module = fx.Options(
 		NewDatabaseHealthCheckProvider,
 		fx.ParamTags(`optional:"true"`),
 	),
+	ProvideAsHealthCheck(
+		NewDatabaseReplicasHealthCheckProvider,
+		fx.ParamTags(`optional:"true"`),
+	),
 	ProvideAsHealthCheck(
 		NewRedisHealthCheckProvider,
 		fx.ParamTags(`optional:"true"`),
@@ -33,5 +33,5 @@ func (rs Resources) Setup(httpHandler HTTPHandler) {
 
 var Module = fx.Options(
 	fx.Invoke(NewResources),
-	fx.Provide(NewHTTPHandler),
+	fx.Provide(NewHTTPHandlerFx),
 )
@@ -15,7 +15,7 @@ const defaultPrefixFmt = "{Name}/{Env.Type}/{Env.Name}/"
 const defaultKeyFmt = "{Key}"
 
 // DefaultKeyTransformer is a default implementation of KeyTransformer
-// It use config.SecretsConfig to format the ID.
+// It use config.SecretsConfig to format the ID, see its defaults, which are also used when it is built in code.
 // The supported placeholders are:
 // - {Name} - the name of the service
 // - {Env.Name} - the name of the environment
@@ -39,7 +39,6 @@ func NewDefaultKeyTransformer(conf config.RootConfig) KeyTransformer {
 	if keyFmt == "" {
 		keyFmt = defaultKeyFmt
 	}
-
 	keyFmt = strings.ReplaceAll(keyFmt, "{Name}", conf.Name)
 	keyFmt = strings.ReplaceAll(keyFmt, "{Env.Name}", conf.Env.Name)
 	keyFmt = strings.ReplaceAll(keyFmt, "{Env.Type}", string(conf.Env.Type))
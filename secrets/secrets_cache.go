@@ -0,0 +1,256 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+// SecretChangeHandler is called with the key, or id, of a secret and its new value when it changes.
+type SecretChangeHandler func(key string, newSecret string)
+
+type cacheKey struct {
+	id       string
+	verbatim bool
+	binary   bool
+}
+
+type cacheEntry struct {
+	secret    []byte
+	fetchedAt time.Time
+}
+
+/*
+CachingSecretsManager decorates a SecretsManager caching the secrets for a TTL. The cached secrets are refreshed in the
+background, and the subscribers are notified when any of them changes, which happens when a secret is rotated.
+
+Subscriptions use the key passed to GetSecret or GetBinarySecret, or the id passed to GetSecretVerbatim or
+GetBinarySecretVerbatim. Only secrets that were read at least once are refreshed.
+*/
+type CachingSecretsManager struct {
+	delegate        SecretsManager
+	ttl             time.Duration
+	refreshInterval time.Duration
+
+	mu             sync.Mutex
+	entries        map[cacheKey]cacheEntry
+	subscribers    map[string][]func(newSecret string)
+	allSubscribers []SecretChangeHandler
+
+	stopChn chan struct{}
+	doneChn chan struct{}
+}
+
+// NewCachingSecretsManager creates a CachingSecretsManager that caches the secrets of the delegate for the ttl, and
+// refreshes them every refreshInterval once started, see Start.
+func NewCachingSecretsManager(delegate SecretsManager, ttl, refreshInterval time.Duration) *CachingSecretsManager {
+	return &CachingSecretsManager{
+		delegate:        delegate,
+		ttl:             ttl,
+		refreshInterval: refreshInterval,
+		entries:         make(map[cacheKey]cacheEntry),
+		subscribers:     make(map[string][]func(newSecret string)),
+	}
+}
+
+// Subscribe registers a handler to be called with the new value of the secret with the given key, or id, when it
+// changes.
+func (s *CachingSecretsManager) Subscribe(key string, handler func(newSecret string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[key] = append(s.subscribers[key], handler)
+}
+
+// SubscribeAll registers a handler to be called when any secret changes.
+func (s *CachingSecretsManager) SubscribeAll(handler SecretChangeHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allSubscribers = append(s.allSubscribers, handler)
+}
+
+func (s *CachingSecretsManager) GetSecret(ctx context.Context, key string) (string, error) {
+	secret, err := s.get(ctx, cacheKey{id: key})
+	return string(secret), err
+}
+
+func (s *CachingSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	secret, err := s.get(ctx, cacheKey{id: id, verbatim: true})
+	return string(secret), err
+}
+
+func (s *CachingSecretsManager) GetBinarySecret(ctx context.Context, key string) ([]byte, error) {
+	return s.get(ctx, cacheKey{id: key, binary: true})
+}
+
+func (s *CachingSecretsManager) GetBinarySecretVerbatim(ctx context.Context, id string) ([]byte, error) {
+	return s.get(ctx, cacheKey{id: id, verbatim: true, binary: true})
+}
+
+func (s *CachingSecretsManager) get(ctx context.Context, key cacheKey) ([]byte, error) {
+	s.mu.Lock()
+	entry, present := s.entries[key]
+	s.mu.Unlock()
+	if present && time.Since(entry.fetchedAt) < s.ttl {
+		return entry.secret, nil
+	}
+
+	secret, err := s.fetch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, secret)
+	return secret, nil
+}
+
+func (s *CachingSecretsManager) fetch(ctx context.Context, key cacheKey) ([]byte, error) {
+	switch {
+	case key.binary && key.verbatim:
+		return s.delegate.GetBinarySecretVerbatim(ctx, key.id)
+	case key.binary:
+		return s.delegate.GetBinarySecret(ctx, key.id)
+	case key.verbatim:
+		secret, err := s.delegate.GetSecretVerbatim(ctx, key.id)
+		return []byte(secret), err
+	default:
+		secret, err := s.delegate.GetSecret(ctx, key.id)
+		return []byte(secret), err
+	}
+}
+
+// store caches the secret, and notifies the subscribers if it replaced a different value.
+func (s *CachingSecretsManager) store(key cacheKey, secret []byte) {
+	s.mu.Lock()
+	prev, present := s.entries[key]
+	s.entries[key] = cacheEntry{secret: secret, fetchedAt: time.Now()}
+	if !present || bytes.Equal(prev.secret, secret) {
+		s.mu.Unlock()
+		return
+	}
+	subscribers := append([]func(string){}, s.subscribers[key.id]...)
+	allSubscribers := append([]SecretChangeHandler{}, s.allSubscribers...)
+	s.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		s.notify(key.id, func() { subscriber(string(secret)) })
+	}
+	for _, subscriber := range allSubscribers {
+		s.notify(key.id, func() { subscriber(key.id, string(secret)) })
+	}
+}
+
+// notify calls the subscriber recovering from any panic, so one failing subscriber does not affect the others.
+func (s *CachingSecretsManager) notify(key string, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.GetLogger().Errorf("Subscriber panicked while applying the change of secret: %s, error: %v", key, r)
+		}
+	}()
+	call()
+}
+
+// Refresh fetches again all the cached secrets, notifying the subscribers of the ones that changed. Secrets that fail
+// to be fetched keep their cached value.
+func (s *CachingSecretsManager) Refresh(ctx context.Context) {
+	s.mu.Lock()
+	keys := make([]cacheKey, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	logger := log.GetLoggerFromCtx(ctx)
+	for _, key := range keys {
+		secret, err := s.fetch(ctx, key)
+		if err != nil {
+			logger.Warnf("Failed to refresh secret: %s, keeping the cached one, error: %s", key.id, err)
+			continue
+		}
+		s.store(key, secret)
+	}
+}
+
+// Start starts refreshing the cached secrets in the background, if the refresh interval is not zero.
+func (s *CachingSecretsManager) Start() {
+	if s.refreshInterval <= 0 {
+		return
+	}
+	s.stopChn = make(chan struct{})
+	s.doneChn = make(chan struct{})
+	go func() {
+		defer close(s.doneChn)
+		ctx := context.Background()
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopChn:
+				return
+			case <-ticker.C:
+				s.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background refresh. It blocks until the background routine is done.
+func (s *CachingSecretsManager) Stop() {
+	if s.stopChn == nil {
+		return
+	}
+	close(s.stopChn)
+	<-s.doneChn
+	s.stopChn = nil
+}
+
+// DecorateWithCache decorates the SecretsManager with a CachingSecretsManager configured with config.SecretsCacheConfig,
+// and starts its background refresh with the fx app.
+func DecorateWithCache(deps struct {
+	fx.In
+
+	SecretsMgr SecretsManager
+	RootConf   config.RootConfig
+	Lifecycle  fx.Lifecycle
+}) SecretsManager {
+	cacheConf := deps.RootConf.Secrets.Cache
+	cachingSecretsMgr := NewCachingSecretsManager(deps.SecretsMgr, cacheConf.TTL, cacheConf.RefreshInterval)
+	deps.Lifecycle.Append(fx.StartStopHook(cachingSecretsMgr.Start, cachingSecretsMgr.Stop))
+	return cachingSecretsMgr
+}
+
+// ReloadConfigOnRotation reloads the config when a secret changes, so the components subscribed to the config.Watcher
+// can apply the new values. It does nothing if no config.Watcher is provided.
+func ReloadConfigOnRotation(deps struct {
+	fx.In
+
+	SecretsMgr *CachingSecretsManager
+	Watcher    *config.Watcher `optional:"true"`
+	LF         *log.LoggerFactory
+}) {
+	if deps.Watcher == nil {
+		return
+	}
+	logger := deps.LF.GetLoggerForType(deps.SecretsMgr)
+	deps.SecretsMgr.SubscribeAll(func(key string, _ string) {
+		logger.Infof("Secret: %s changed, reloading config", key)
+		if err := deps.Watcher.Reload(); err != nil {
+			logger.Errorf("Failed to reload config after secret: %s changed, error: %s", key, err)
+		}
+	})
+}
+
+// ModuleCache decorates the SecretsManager with a CachingSecretsManager, which is also provided to subscribe to the
+// changes of the secrets. If a config.Watcher is provided, the config is reloaded when a secret changes. It must be
+// used together with a SecretsManager module, like ModuleAWS.
+var ModuleCache = fx.Options(
+	fx.Decorate(DecorateWithCache),
+	fx.Provide(func(secretsMgr SecretsManager) *CachingSecretsManager {
+		return secretsMgr.(*CachingSecretsManager)
+	}),
+	fx.Invoke(ReloadConfigOnRotation),
+)
@@ -0,0 +1,114 @@
+package secrets_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/secrets"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+// countingSecretsManager serves the secrets from a map, counting the calls.
+type countingSecretsManager struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (s *countingSecretsManager) GetSecret(_ context.Context, key string) (string, error) {
+	s.calls++
+	return s.secrets[key], nil
+}
+
+func (s *countingSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	return s.GetSecret(ctx, id)
+}
+
+func (s *countingSecretsManager) GetBinarySecret(ctx context.Context, key string) ([]byte, error) {
+	secret, err := s.GetSecret(ctx, key)
+	return []byte(secret), err
+}
+
+func (s *countingSecretsManager) GetBinarySecretVerbatim(ctx context.Context, id string) ([]byte, error) {
+	return s.GetBinarySecret(ctx, id)
+}
+
+func TestCachingSecretsManager(t *testing.T) {
+	ctx := context.Background()
+	delegate := &countingSecretsManager{secrets: map[string]string{"database.pass": "v1"}}
+	cachingSecretsMgr := secrets.NewCachingSecretsManager(delegate, time.Hour, 0)
+
+	var changes []string
+	cachingSecretsMgr.Subscribe("database.pass", func(newSecret string) {
+		changes = append(changes, newSecret)
+	})
+	var changedKeys []string
+	cachingSecretsMgr.SubscribeAll(func(key, _ string) {
+		panic("must not affect the other subscribers")
+	})
+	cachingSecretsMgr.SubscribeAll(func(key, _ string) {
+		changedKeys = append(changedKeys, key)
+	})
+
+	for range 3 {
+		secret, err := cachingSecretsMgr.GetSecret(ctx, "database.pass")
+		require.NoError(t, err)
+		require.Equal(t, "v1", secret)
+	}
+	require.Equal(t, 1, delegate.calls)
+
+	// Nothing changed
+	cachingSecretsMgr.Refresh(ctx)
+	require.Equal(t, 2, delegate.calls)
+	require.Empty(t, changes)
+
+	// Rotation
+	delegate.secrets["database.pass"] = "v2"
+	cachingSecretsMgr.Refresh(ctx)
+	require.Equal(t, []string{"v2"}, changes)
+	require.Equal(t, []string{"database.pass"}, changedKeys)
+
+	secret, err := cachingSecretsMgr.GetSecret(ctx, "database.pass")
+	require.NoError(t, err)
+	require.Equal(t, "v2", secret)
+	require.Equal(t, 3, delegate.calls)
+}
+
+func TestCachingSecretsManagerTTL(t *testing.T) {
+	ctx := context.Background()
+	delegate := &countingSecretsManager{secrets: map[string]string{"key": "v1"}}
+	cachingSecretsMgr := secrets.NewCachingSecretsManager(delegate, time.Millisecond, 0)
+
+	_, err := cachingSecretsMgr.GetSecret(ctx, "key")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = cachingSecretsMgr.GetSecret(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, 2, delegate.calls)
+}
+
+func TestModuleCache(t *testing.T) {
+	t.Setenv("SECRETS_ENVPREFIX", "APP_SECRET_")
+	t.Setenv("SECRETS_PREFIXFMT", "{Env.Name}/")
+	t.Setenv("APP_SECRET_TEST_DATABASE_PASS", "s3cr3t")
+
+	var ctx context.Context
+	var secretsMgr secrets.SecretsManager
+	var cachingSecretsMgr *secrets.CachingSecretsManager
+	test.FxUnit(t, secrets.ModuleEnv, secrets.ModuleCache).Populate(&ctx, &secretsMgr, &cachingSecretsMgr)
+	require.Same(t, cachingSecretsMgr, secretsMgr)
+
+	var changes []string
+	cachingSecretsMgr.Subscribe("database.pass", func(newSecret string) {
+		changes = append(changes, newSecret)
+	})
+	secret, err := secretsMgr.GetSecret(ctx, "database.pass")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	t.Setenv("APP_SECRET_TEST_DATABASE_PASS", "r0t4t3d")
+	cachingSecretsMgr.Refresh(ctx)
+	require.Equal(t, []string{"r0t4t3d"}, changes)
+}
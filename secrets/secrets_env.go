@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"strings"
+	"unicode"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/di"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// EnvSecretsManager reads every secret from an env var. The name of the env var is the prefix set with
+// config.SecretsConfig.EnvPrefix followed by the secret id in upper case, with any character that is not a letter or a
+// digit replaced by "_". For example, with the prefix "SECRET_", the id "dev1/database.pass" is read from
+// SECRET_DEV1_DATABASE_PASS.
+//
+// Binary secrets must be encoded with standard base64.
+type EnvSecretsManager struct {
+	keyTransformer KeyTransformer
+	prefix         string
+}
+
+func NewEnvSecretsManager(deps struct {
+	fx.In
+
+	RootConf       config.RootConfig
+	KeyTransformer KeyTransformer `optional:"true"`
+}) *EnvSecretsManager {
+	if deps.KeyTransformer == nil {
+		deps.KeyTransformer = NewDefaultKeyTransformer(deps.RootConf)
+	}
+	return &EnvSecretsManager{
+		keyTransformer: deps.KeyTransformer,
+		prefix:         deps.RootConf.Secrets.EnvPrefix,
+	}
+}
+
+func (s *EnvSecretsManager) GetSecret(ctx context.Context, key string) (string, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetSecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetSecretVerbatim(ctx, fullId)
+}
+
+func (s *EnvSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetSecretVerbatim: %s", id)
+	envKey := s.EnvKey(id)
+	secret, present := os.LookupEnv(envKey)
+	if !present {
+		return "", errors.Newf(errors.ErrCodeNotFound, "secret not found: %s, in env var: %s", id, envKey)
+	}
+	return secret, nil
+}
+
+func (s *EnvSecretsManager) GetBinarySecret(ctx context.Context, key string) ([]byte, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetBinarySecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetBinarySecretVerbatim(ctx, fullId)
+}
+
+func (s *EnvSecretsManager) GetBinarySecretVerbatim(ctx context.Context, id string) ([]byte, error) {
+	secret, err := s.GetSecretVerbatim(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	binarySecret, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, errors.Newf(errors.ErrCodeBadState, "invalid base64 binary secret: %s, error: %w", id, err)
+	}
+	return binarySecret, nil
+}
+
+// EnvKey returns the name of the env var that holds the secret with the given id.
+func (s *EnvSecretsManager) EnvKey(id string) string {
+	return s.prefix + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, id)
+}
+
+var ModuleEnv = fx.Options(
+	Module,
+	di.FxProvideAs[SecretsManager](NewEnvSecretsManager, nil, nil),
+)
@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/di"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// FileSecretsManager reads every secret from a file in a directory, like the ones mounted by Kubernetes or Docker.
+// The file name is the secret id, which can contain "/" to use sub-directories. The directory is set with
+// config.SecretsConfig.Dir.
+//
+// The trailing new line of the file is removed for string secrets, binary secrets are returned as is.
+type FileSecretsManager struct {
+	keyTransformer KeyTransformer
+	dir            string
+}
+
+func NewFileSecretsManager(deps struct {
+	fx.In
+
+	RootConf       config.RootConfig
+	KeyTransformer KeyTransformer `optional:"true"`
+}) *FileSecretsManager {
+	if deps.KeyTransformer == nil {
+		deps.KeyTransformer = NewDefaultKeyTransformer(deps.RootConf)
+	}
+	return &FileSecretsManager{
+		keyTransformer: deps.KeyTransformer,
+		dir:            deps.RootConf.Secrets.Dir,
+	}
+}
+
+func (s *FileSecretsManager) GetSecret(ctx context.Context, key string) (string, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetSecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetSecretVerbatim(ctx, fullId)
+}
+
+func (s *FileSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	secret, err := s.GetBinarySecretVerbatim(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(secret), "\n"), "\r"), nil
+}
+
+func (s *FileSecretsManager) GetBinarySecret(ctx context.Context, key string) ([]byte, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetBinarySecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetBinarySecretVerbatim(ctx, fullId)
+}
+
+func (s *FileSecretsManager) GetBinarySecretVerbatim(ctx context.Context, id string) ([]byte, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetBinarySecretVerbatim: %s", id)
+	// The id must not escape the directory
+	if !filepath.IsLocal(id) {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid secret id: %s, it must be a path inside: %s", id, s.dir)
+	}
+	secret, err := os.ReadFile(filepath.Join(s.dir, id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Newf(errors.ErrCodeNotFound, "secret not found: %s, in: %s", id, s.dir)
+		}
+		return nil, errors.NewUnknownf("failed to read secret: %s, in: %s, error: %w", id, s.dir, err)
+	}
+	return secret, nil
+}
+
+var ModuleFile = fx.Options(
+	Module,
+	di.FxProvideAs[SecretsManager](NewFileSecretsManager, nil, nil),
+)
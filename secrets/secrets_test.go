@@ -0,0 +1,77 @@
+package secrets_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/secrets"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+func TestFileSecretsManager(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "test"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test", "database.pass"), []byte("s3cr3t\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), []byte{0, 1, 2, '\n'}, 0o600))
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("SECRETS_PREFIXFMT", "{Env.Name}/")
+
+	var ctx context.Context
+	var secretsMgr secrets.SecretsManager
+	test.FxUnit(t, secrets.ModuleFile).Populate(&ctx, &secretsMgr)
+
+	secret, err := secretsMgr.GetSecret(ctx, "database.pass")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	binarySecret, err := secretsMgr.GetBinarySecretVerbatim(ctx, "tls.key")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2, '\n'}, binarySecret)
+
+	_, err = secretsMgr.GetSecret(ctx, "missing")
+	var fwErr *errors.Error
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeNotFound, fwErr.Code)
+
+	_, err = secretsMgr.GetSecretVerbatim(ctx, "../etc/passwd")
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeBadArgument, fwErr.Code)
+}
+
+func TestEnvSecretsManager(t *testing.T) {
+	t.Setenv("SECRETS_ENVPREFIX", "APP_SECRET_")
+	t.Setenv("SECRETS_PREFIXFMT", "{Env.Name}/")
+	t.Setenv("APP_SECRET_TEST_DATABASE_PASS", "s3cr3t")
+	t.Setenv("APP_SECRET_TLS_KEY", "AAEC")
+
+	var ctx context.Context
+	var secretsMgr secrets.SecretsManager
+	test.FxUnit(t, secrets.ModuleEnv).Populate(&ctx, &secretsMgr)
+
+	secret, err := secretsMgr.GetSecret(ctx, "database.pass")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	binarySecret, err := secretsMgr.GetBinarySecretVerbatim(ctx, "tls-key")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2}, binarySecret)
+
+	_, err = secretsMgr.GetSecret(ctx, "missing")
+	var fwErr *errors.Error
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeNotFound, fwErr.Code)
+}
+
+func TestDefaultKeyTransformer(t *testing.T) {
+	conf := config.RootConfig{Name: "app", Env: config.EnvConfig{Name: "qa1", Type: config.EnvTypeProd}}
+	require.Equal(t, "app/prod/qa1/database.pass", secrets.NewDefaultKeyTransformer(conf).Transform("database.pass"))
+
+	conf.Secrets = config.SecretsConfig{PrefixFmt: "{Env.Name}-", KeyFmt: "{Name}.{Key}"}
+	require.Equal(t, "qa1-app.database.pass", secrets.NewDefaultKeyTransformer(conf).Transform("database.pass"))
+}
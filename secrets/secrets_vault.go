@@ -0,0 +1,290 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/di"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/sync"
+)
+
+// vaultSingleValueKey is the key of the KV v2 secrets that hold a single value.
+const vaultSingleValueKey = "value"
+
+// vaultVersionParam is the suffix that pins the version of a secret in its id, like: my-server/db?version=3
+const vaultVersionParam = "?version="
+
+/*
+VaultSecretsManager reads the secrets from a HashiCorp Vault KV v2 secrets engine using its HTTP API, it is configured
+with config.VaultConfig.
+
+The id of a secret is its path inside the secrets engine. A version can be pinned by adding "?version=<n>" to the id,
+like: my-server/prod/db?version=3, otherwise the latest version is read.
+
+KV v2 secrets are maps of keys and values. If the secret only has the key "value", its value is returned. Otherwise,
+the whole map is returned as JSON, so single fields can be extracted in the config, like: <secret:my-server/db#password>
+Binary secrets must be stored in the "value" key, encoded with standard base64.
+*/
+type VaultSecretsManager struct {
+	keyTransformer KeyTransformer
+	conf           config.VaultConfig
+	client         *http.Client
+
+	// The token and its expiration when using AppRole auth, the expiration is zero if it doesn't expire
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewVaultSecretsManager(deps struct {
+	fx.In
+
+	RootConf       config.RootConfig
+	KeyTransformer KeyTransformer `optional:"true"`
+}) (*VaultSecretsManager, error) {
+	if deps.KeyTransformer == nil {
+		deps.KeyTransformer = NewDefaultKeyTransformer(deps.RootConf)
+	}
+	vaultConf := deps.RootConf.Secrets.Vault
+	if vaultConf.Address == "" {
+		vaultConf.Address = os.Getenv("VAULT_ADDR")
+	}
+	if vaultConf.Token == "" {
+		vaultConf.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if vaultConf.Address == "" {
+		return nil, errors.Newf(errors.ErrCodeBadArgument, "vault address is required, set secrets.vault.address")
+	}
+	if vaultConf.Token == "" && vaultConf.AppRole.RoleID == "" {
+		return nil, errors.Newf(
+			errors.ErrCodeBadArgument,
+			"vault auth is required, set secrets.vault.token or secrets.vault.appRole.roleID",
+		)
+	}
+	vaultConf.Address = strings.TrimSuffix(vaultConf.Address, "/")
+	return &VaultSecretsManager{
+		keyTransformer: deps.KeyTransformer,
+		conf:           vaultConf,
+		client:         &http.Client{Timeout: vaultConf.Timeout},
+		token:          vaultConf.Token,
+	}, nil
+}
+
+func (s *VaultSecretsManager) GetSecret(ctx context.Context, key string) (string, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetSecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetSecretVerbatim(ctx, fullId)
+}
+
+func (s *VaultSecretsManager) GetSecretVerbatim(ctx context.Context, id string) (string, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetSecretVerbatim: %s", id)
+	data, err := s.readSecret(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if value, ok := data[vaultSingleValueKey].(string); ok && len(data) == 1 {
+		return value, nil
+	}
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.NewUnknownf("failed to marshal vault secret: %s, error: %w", id, err)
+	}
+	return string(jsonBytes), nil
+}
+
+func (s *VaultSecretsManager) GetBinarySecret(ctx context.Context, key string) ([]byte, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetBinarySecret: %s", key)
+	fullId := s.keyTransformer.Transform(key)
+	return s.GetBinarySecretVerbatim(ctx, fullId)
+}
+
+func (s *VaultSecretsManager) GetBinarySecretVerbatim(ctx context.Context, id string) ([]byte, error) {
+	log.GetLoggerFromCtx(ctx).Infof("GetBinarySecretVerbatim: %s", id)
+	data, err := s.readSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[vaultSingleValueKey].(string)
+	if !ok {
+		return nil, errors.Newf(errors.ErrCodeBadState, "vault binary secret: %s, has no %q key", id, vaultSingleValueKey)
+	}
+	binarySecret, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Newf(errors.ErrCodeBadState, "invalid base64 binary secret: %s, error: %w", id, err)
+	}
+	return binarySecret, nil
+}
+
+type vaultKVResponse struct {
+	Data *struct {
+		Data map[string]any `json:"data"`
+	} `json:"data"`
+}
+
+// readSecret reads the data of the secret, pinning the version if the id has one.
+func (s *VaultSecretsManager) readSecret(ctx context.Context, id string) (map[string]any, error) {
+	secretPath, versionStr, hasVersion := strings.Cut(id, vaultVersionParam)
+	query := url.Values{}
+	if hasVersion {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			return nil, errors.Newf(errors.ErrCodeBadArgument, "invalid vault secret version: %s, in id: %s", versionStr, id)
+		}
+		query.Set("version", versionStr)
+	}
+
+	var resp vaultKVResponse
+	err := s.doRequest(ctx, http.MethodGet, s.conf.Mount+"/data/"+strings.TrimPrefix(secretPath, "/"), query, nil, &resp, true)
+	if err != nil {
+		return nil, err
+	}
+	// Deleted and destroyed versions have no data
+	if resp.Data == nil || resp.Data.Data == nil {
+		return nil, errors.Newf(errors.ErrCodeNotFound, "vault secret not found: %s", id)
+	}
+	return resp.Data.Data, nil
+}
+
+type vaultLoginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+// getToken returns the token to authenticate the requests, logging in with AppRole if it is used and there is no
+// valid token.
+func (s *VaultSecretsManager) getToken(ctx context.Context) (string, error) {
+	if s.conf.AppRole.RoleID == "" {
+		return s.conf.Token, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.tokenExpiry.IsZero() || time.Now().Before(s.tokenExpiry)) {
+		return s.token, nil
+	}
+
+	log.GetLoggerFromCtx(ctx).Debugf("Logging in to vault with AppRole: %s", s.conf.AppRole.RoleID)
+	body := map[string]string{
+		"role_id":   s.conf.AppRole.RoleID,
+		"secret_id": s.conf.AppRole.SecretID,
+	}
+	var resp vaultLoginResponse
+	err := s.doRequest(ctx, http.MethodPost, "auth/"+s.conf.AppRole.Mount+"/login", nil, body, &resp, false)
+	if err != nil {
+		return "", errors.NewUnknownf("failed to login to vault with AppRole: %s, error: %w", s.conf.AppRole.RoleID, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", errors.Newf(errors.ErrCodeBadState, "vault AppRole login returned no token")
+	}
+	s.token = resp.Auth.ClientToken
+	s.tokenExpiry = time.Time{}
+	if lease := time.Duration(resp.Auth.LeaseDuration) * time.Second; lease > 0 {
+		// Renew it before it expires
+		s.tokenExpiry = time.Now().Add(lease - lease/10)
+	}
+	return s.token, nil
+}
+
+// invalidateToken forces a new AppRole login on the next request, if the token is still the given one.
+func (s *VaultSecretsManager) invalidateToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// doRequest calls the vault API at /v1/<apiPath>, decoding the JSON response into out. Authenticated requests are
+// retried once with a new token if it was rejected and AppRole auth is used.
+func (s *VaultSecretsManager) doRequest(
+	ctx context.Context,
+	method string,
+	apiPath string,
+	query url.Values,
+	body any,
+	out any,
+	authenticated bool,
+) error {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return errors.NewUnknownf("failed to marshal vault request, error: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		reqURL := s.conf.Address + "/v1/" + apiPath
+		if len(query) > 0 {
+			reqURL += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return errors.NewUnknownf("failed to create vault request, error: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.conf.Namespace != "" {
+			req.Header.Set("X-Vault-Namespace", s.conf.Namespace)
+		}
+		var token string
+		if authenticated {
+			if token, err = s.getToken(ctx); err != nil {
+				return err
+			}
+			req.Header.Set("X-Vault-Token", token)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return errors.NewUnknownf("failed to call vault, error: %w", err)
+		}
+		respBytes, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return errors.NewUnknownf("failed to read vault response, error: %w", err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusForbidden && authenticated && s.conf.AppRole.RoleID != "" && attempt == 0:
+			s.invalidateToken(token)
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			return errors.Newf(errors.ErrCodeNotFound, "vault path not found: %s", apiPath)
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			var errResp struct {
+				Errors []string `json:"errors"`
+			}
+			_ = json.Unmarshal(respBytes, &errResp)
+			return errors.NewUnknownf(
+				"vault returned status: %d, for path: %s, errors: %s",
+				resp.StatusCode,
+				apiPath,
+				strings.Join(errResp.Errors, "; "),
+			)
+		}
+		if err = json.Unmarshal(respBytes, out); err != nil {
+			return errors.NewUnknownf("failed to unmarshal vault response, error: %w", err)
+		}
+		return nil
+	}
+}
+
+var ModuleVault = fx.Options(
+	Module,
+	di.FxProvideAs[SecretsManager](NewVaultSecretsManager, nil, nil),
+)
@@ -0,0 +1,180 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/secrets"
+	"github.com/southernlabs-io/go-fw/sync"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+// fakeVault is a minimal stand-in of the Vault KV v2 and AppRole HTTP APIs.
+type fakeVault struct {
+	mu          sync.Mutex
+	validTokens map[string]bool
+	logins      int
+	// versions of the secrets by path, the last one is the latest
+	secrets map[string][]map[string]any
+}
+
+func newFakeVault(t *testing.T) *httptest.Server {
+	vault := &fakeVault{
+		validTokens: map[string]bool{"root-token": true},
+		secrets: map[string][]map[string]any{
+			"test/database": {
+				{"username": "admin", "password": "old"},
+				{"username": "admin", "password": "new"},
+			},
+			"test/api.key": {{"value": "s3cr3t"}},
+			"tls":          {{"value": "AAEC"}},
+		},
+	}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if r.Header.Get("X-Vault-Namespace") != "team" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["invalid role or secret id"]}`))
+			return
+		}
+		v.logins++
+		token := "approle-token-" + string(rune('0'+v.logins))
+		v.validTokens[token] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"auth": map[string]any{"client_token": token, "lease_duration": 3600},
+		})
+		return
+	}
+
+	if !v.validTokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+		return
+	}
+	secretPath, found := strings.CutPrefix(r.URL.Path, "/v1/secret/data/")
+	versions, present := v.secrets[secretPath]
+	if r.Method != http.MethodGet || !found || !present {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors": []}`))
+		return
+	}
+	version := len(versions)
+	if versionStr := r.URL.Query().Get("version"); versionStr != "" {
+		version = int(versionStr[0] - '0')
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"data": map[string]any{
+			"data":     versions[version-1],
+			"metadata": map[string]any{"version": version},
+		},
+	})
+}
+
+func (v *fakeVault) revokeTokens() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.validTokens = map[string]bool{}
+}
+
+func TestVaultSecretsManagerToken(t *testing.T) {
+	server := newFakeVault(t)
+	t.Setenv("SECRETS_VAULT_ADDRESS", server.URL)
+	t.Setenv("SECRETS_VAULT_NAMESPACE", "team")
+	t.Setenv("SECRETS_VAULT_TOKEN", "root-token")
+	t.Setenv("SECRETS_PREFIXFMT", "{Env.Name}/")
+
+	var ctx context.Context
+	var secretsMgr secrets.SecretsManager
+	test.FxUnit(t, secrets.ModuleVault).Populate(&ctx, &secretsMgr)
+
+	secret, err := secretsMgr.GetSecret(ctx, "api.key")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	secret, err = secretsMgr.GetSecret(ctx, "database")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"username": "admin", "password": "new"}`, secret)
+
+	secret, err = secretsMgr.GetSecretVerbatim(ctx, "test/database?version=1")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"username": "admin", "password": "old"}`, secret)
+
+	binarySecret, err := secretsMgr.GetBinarySecretVerbatim(ctx, "tls")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2}, binarySecret)
+
+	_, err = secretsMgr.GetSecret(ctx, "missing")
+	var fwErr *errors.Error
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeNotFound, fwErr.Code)
+
+	_, err = secretsMgr.GetSecretVerbatim(ctx, "tls?version=latest")
+	require.ErrorAs(t, err, &fwErr)
+	require.Equal(t, errors.ErrCodeBadArgument, fwErr.Code)
+}
+
+func TestVaultSecretsManagerAppRole(t *testing.T) {
+	server := newFakeVault(t)
+	vault := server.Config.Handler.(*fakeVault)
+	t.Setenv("SECRETS_VAULT_ADDRESS", server.URL)
+	t.Setenv("SECRETS_VAULT_NAMESPACE", "team")
+	t.Setenv("SECRETS_VAULT_APPROLE_ROLEID", "role")
+	t.Setenv("SECRETS_VAULT_APPROLE_SECRETID", "secret")
+
+	var ctx context.Context
+	var secretsMgr secrets.SecretsManager
+	test.FxUnit(t, secrets.ModuleVault).Populate(&ctx, &secretsMgr)
+
+	secret, err := secretsMgr.GetSecretVerbatim(ctx, "test/api.key")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+	secret, err = secretsMgr.GetSecretVerbatim(ctx, "test/api.key")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+	require.Equal(t, 1, vault.logins)
+
+	// A rejected token triggers a new login
+	vault.revokeTokens()
+	secret, err = secretsMgr.GetSecretVerbatim(ctx, "test/api.key")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+	require.Equal(t, 2, vault.logins)
+}
+
+func TestVaultSecretsManagerConfig(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+
+	var rootConf config.RootConfig
+	rootConf.Secrets.Vault.Address = "http://localhost:8200"
+	_, err := secrets.NewVaultSecretsManager(struct {
+		fx.In
+
+		RootConf       config.RootConfig
+		KeyTransformer secrets.KeyTransformer `optional:"true"`
+	}{RootConf: rootConf})
+	require.ErrorContains(t, err, "vault auth is required")
+}
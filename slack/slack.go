@@ -5,4 +5,5 @@ import "go.uber.org/fx"
 var Module = fx.Options(
 	fx.Provide(NewSlackClient),
 	fx.Decorate(NewFxLoggerFactory),
+	fx.Invoke(SubscribeToConfigChanges),
 )
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/iancoleman/strcase"
+	"go.uber.org/fx"
 
 	"github.com/southernlabs-io/go-fw/config"
 	"github.com/southernlabs-io/go-fw/errors"
@@ -29,7 +32,8 @@ const (
 
 type Client struct {
 	conf            config.Config
-	httpClient      *http.Client
+	slackConf       atomic.Pointer[config.SlackConfig]
+	httpClient      atomic.Pointer[http.Client]
 	fullMsgTemplate *template.Template
 }
 
@@ -71,13 +75,43 @@ func NewSlackClient(conf config.Config, lf *log.LoggerFactory) *Client {
 		panic(errors.Newf(errors.ErrCodeBadState, "failed to parse Slack message template: %w", err))
 	}
 
-	return &Client{
+	client := &Client{
 		conf:            conf,
 		fullMsgTemplate: fullMsgTemplate,
-		httpClient: &http.Client{
-			Timeout: time.Duration(conf.Slack.HTTPTimeoutSeconds) * time.Second,
-		},
 	}
+	client.UpdateSlackConfig(conf.Slack)
+	return client
+}
+
+// UpdateSlackConfig applies the given Slack config to the client. Disabling it will make the client skip sending
+// messages, but a client can't be enabled if it was disabled when it was created, since NewSlackClient returns nil.
+func (s *Client) UpdateSlackConfig(slackConf config.SlackConfig) {
+	s.httpClient.Store(&http.Client{
+		Timeout: time.Duration(slackConf.HTTPTimeoutSeconds) * time.Second,
+	})
+	s.slackConf.Store(&slackConf)
+}
+
+// SubscribeToConfigChanges applies the Slack config changes to the client. It does nothing if the client is disabled
+// or no config.Watcher is provided.
+func SubscribeToConfigChanges(deps struct {
+	fx.In
+
+	SlackClient *Client
+	Watcher     *config.Watcher `optional:"true"`
+	LF          *log.LoggerFactory
+}) {
+	if deps.SlackClient == nil || deps.Watcher == nil {
+		return
+	}
+	logger := deps.LF.GetLoggerForType(deps.SlackClient)
+	deps.Watcher.Subscribe(func(oldConf, newConf config.Config) {
+		if reflect.DeepEqual(oldConf.Slack, newConf.Slack) {
+			return
+		}
+		logger.Infof("Slack config changed, applying it")
+		deps.SlackClient.UpdateSlackConfig(newConf.Slack)
+	})
 }
 
 func (s *Client) Infof(message string, args ...any) error {
@@ -138,13 +172,16 @@ func (s *Client) send(channelType WebhookChannelType, payload map[string]any) er
 }
 
 func (s *Client) sendRaw(channelType WebhookChannelType, bodyBytes []byte) error {
-	// Check if the channel type is enabled
+	// Check if the client and the channel type are enabled
+	if !s.slackConf.Load().Enabled {
+		return nil
+	}
 	webhookURL := s.getWebhookURL(channelType)
 	if webhookURL == "" {
 		return nil
 	}
 
-	resp, err := s.httpClient.Post(webhookURL, "application/json", bytes.NewBuffer(bodyBytes))
+	resp, err := s.httpClient.Load().Post(webhookURL, "application/json", bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return errors.Newf(
 			errors.ErrCodeUnknown,
@@ -172,7 +209,7 @@ func (s *Client) sendRaw(channelType WebhookChannelType, bodyBytes []byte) error
 // URL for the next channel type in the order of Error -> Warn -> Info. If none of the URLs are configured, it will
 // panic.
 func (s *Client) getWebhookURL(channelType WebhookChannelType) string {
-	urls := s.conf.Slack.WebhookURLs
+	urls := s.slackConf.Load().WebhookURLs
 	switch channelType {
 	case WebhookChannelTypeInfo:
 		return urls.Info
@@ -0,0 +1,82 @@
+package tenancy
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/rest"
+	"github.com/southernlabs-io/go-fw/rest/middleware"
+)
+
+// Middleware sets the tenant of the requests in their context. The tenant is the one of the principal, when it is a
+// TenantPrincipal, or, only with config.TenancyConfig.AllowHeaderTenant, the one in the header. The requests without a
+// tenant, or with a header that doesn't match the tenant of the principal, are rejected with errors.ErrCodeNotAllowed.
+// The paths outside of the base path, like /health, and the ones excluded from authentication, are not scoped to a
+// tenant.
+type Middleware struct {
+	middleware.BaseMiddleware
+}
+
+func NewMiddleware(conf config.Config, lf *log.LoggerFactory) *Middleware {
+	return &Middleware{
+		middleware.BaseMiddleware{Conf: conf, Logger: lf.GetLoggerForType(Middleware{})},
+	}
+}
+
+func (m *Middleware) Setup(httpHandler rest.HTTPHandler) {
+	httpHandler.Root.Use(m.Run)
+}
+
+// Priority is after middleware.MiddlewarePriorityAuthN, so the principal is set.
+func (m *Middleware) Priority() middleware.MiddlewarePriority {
+	return middleware.MiddlewarePriorityHeader
+}
+
+func (m *Middleware) Run(ctx *gin.Context) {
+	if !strings.HasPrefix(ctx.FullPath(), m.Conf.HttpServer.BasePath) || ctx.GetBool(middleware.AuthNExcludedCtxKey) {
+		return
+	}
+	tenantID, err := m.resolveTenantID(ctx)
+	if err != nil {
+		_ = ctx.Error(err)
+		ctx.Abort()
+		return
+	}
+	SetTenantID(ctx, tenantID)
+	log.CtxAppendLoggerAttrs(ctx, slog.String("tenant", tenantID))
+}
+
+func (m *Middleware) resolveTenantID(ctx *gin.Context) (string, error) {
+	headerTenantID := ctx.GetHeader(m.Conf.Tenancy.Header)
+	principal, _ := middleware.GetPrincipal(ctx)
+	if tenantPrincipal, is := principal.(TenantPrincipal); is && tenantPrincipal.GetTenantID() != "" {
+		tenantID := tenantPrincipal.GetTenantID()
+		if headerTenantID != "" && headerTenantID != tenantID {
+			return "", errors.Newf(
+				errors.ErrCodeNotAllowed,
+				"principal of tenant: %s is not allowed in tenant: %s",
+				tenantID,
+				headerTenantID,
+			)
+		}
+		return tenantID, nil
+	}
+	if !m.Conf.Tenancy.AllowHeaderTenant {
+		return "", errors.Newf(errors.ErrCodeNotAllowed, "no tenant in the principal")
+	}
+	if headerTenantID == "" {
+		return "", errors.Newf(
+			errors.ErrCodeNotAllowed,
+			"no tenant in the principal nor in header: %s",
+			m.Conf.Tenancy.Header,
+		)
+	}
+	return headerTenantID, nil
+}
+
+var Module = middleware.ProvideAsMiddleware(NewMiddleware)
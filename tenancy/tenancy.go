@@ -0,0 +1,123 @@
+/*
+Package tenancy isolates the tenants of the app with Postgres row level security (RLS).
+
+The Middleware resolves the tenant of every request, and stores it in the context, so every transaction of the request
+sets it in the app.tenant_id setting, see database.SetTxSetting. The Policy of every tenant table only lets the
+transactions see, and write, the rows of their tenant. Add it in a Go migration:
+
+	func init() {
+		policy := tenancy.Policy{Table: "orders", Type: "uuid"}
+		goose.AddMigrationContext(policy.Up, policy.Down)
+	}
+
+The code without a request, like workers, sets the tenant with SetTenantID. Row, Rows and Scan with a tenant need a
+transaction of database.WithTx or database.RunInTx.
+*/
+package tenancy
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+)
+
+// SettingTenantID is the Postgres run-time parameter with the tenant ID of the transaction, used by the policies.
+const SettingTenantID = "app.tenant_id"
+
+// TenantPrincipal is a middleware.Principal that belongs to a tenant.
+type TenantPrincipal interface {
+	GetTenantID() string
+}
+
+// SetTenantID returns a context whose transactions are scoped to the tenant.
+func SetTenantID(ctx context.Context, tenantID string) context.Context {
+	return database.SetTxSetting(ctx, SettingTenantID, tenantID)
+}
+
+// GetTenantID returns the tenant ID of the context, if there is one.
+func GetTenantID(ctx context.Context) (string, bool) {
+	tenantID, found := database.GetTxSettings(ctx)[SettingTenantID]
+	return tenantID, found
+}
+
+// MustGetTenantID returns the tenant ID of the context, or panics if there is none.
+func MustGetTenantID(ctx context.Context) string {
+	if tenantID, found := GetTenantID(ctx); found {
+		return tenantID
+	}
+	panic(errors.Newf(errors.ErrCodeBadState, "no tenant in context"))
+}
+
+// Policy is the RLS policy of a tenant table.
+type Policy struct {
+	// Table is the name of the table, with the schema if it isn't in the search path, like "sales.orders".
+	Table string
+	// Column is the column with the tenant ID, tenant_id by default.
+	Column string
+	// Type is the Postgres type of Column, text by default, like uuid or bigint.
+	Type string
+}
+
+// UpSQL returns the statements that enable RLS on the table, even for its owner, with the policy that only allows the
+// rows of the tenant of the transaction. Without a tenant, no row is allowed.
+func (p Policy) UpSQL() string {
+	table := p.table()
+	column := p.Column
+	if column == "" {
+		column = "tenant_id"
+	}
+	columnType := p.Type
+	if columnType == "" {
+		columnType = "text"
+	}
+	// After the transaction, the setting stays in the connection, empty
+	check := fmt.Sprintf(
+		"%s = NULLIF(current_setting('%s', true), '')::%s",
+		pgx.Identifier{column}.Sanitize(),
+		SettingTenantID,
+		columnType,
+	)
+	return fmt.Sprintf(`
+		ALTER TABLE %[1]s ENABLE ROW LEVEL SECURITY;
+		ALTER TABLE %[1]s FORCE ROW LEVEL SECURITY;
+		CREATE POLICY tenant_isolation ON %[1]s USING (%[2]s) WITH CHECK (%[2]s)`,
+		table,
+		check,
+	)
+}
+
+// DownSQL returns the statements that drop the policy, and disable RLS on the table.
+func (p Policy) DownSQL() string {
+	return fmt.Sprintf(`
+		DROP POLICY IF EXISTS tenant_isolation ON %[1]s;
+		ALTER TABLE %[1]s NO FORCE ROW LEVEL SECURITY;
+		ALTER TABLE %[1]s DISABLE ROW LEVEL SECURITY`,
+		p.table(),
+	)
+}
+
+// Up runs UpSQL, it is a goose.GoMigrationContext.
+func (p Policy) Up(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, p.UpSQL()); err != nil {
+		return errors.NewUnknownf("failed to create the tenant policy of: %s, error: %w", p.Table, err)
+	}
+	return nil
+}
+
+// Down runs DownSQL, it is a goose.GoMigrationContext.
+func (p Policy) Down(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, p.DownSQL()); err != nil {
+		return errors.NewUnknownf("failed to drop the tenant policy of: %s, error: %w", p.Table, err)
+	}
+	return nil
+}
+
+func (p Policy) table() string {
+	return pgx.Identifier(strings.Split(p.Table, ".")).Sanitize()
+}
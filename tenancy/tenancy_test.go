@@ -0,0 +1,193 @@
+package tenancy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+	"github.com/southernlabs-io/go-fw/rest/middleware"
+	"github.com/southernlabs-io/go-fw/tenancy"
+	"github.com/southernlabs-io/go-fw/test"
+)
+
+type tenantPrincipal struct {
+	tenantID string
+}
+
+func (p tenantPrincipal) GetID() any                        { return "user" }
+func (p tenantPrincipal) GetName() string                   { return "user" }
+func (p tenantPrincipal) GetEmail() string                  { return "user@example.com" }
+func (p tenantPrincipal) GetType() middleware.PrincipalType { return "user" }
+func (p tenantPrincipal) GetTenantID() string               { return p.tenantID }
+
+func TestTenantID(t *testing.T) {
+	ctx := context.Background()
+	_, found := tenancy.GetTenantID(ctx)
+	require.False(t, found)
+	require.Panics(t, func() { tenancy.MustGetTenantID(ctx) })
+
+	tenantCtx := tenancy.SetTenantID(ctx, "a")
+	require.Equal(t, "a", tenancy.MustGetTenantID(tenantCtx))
+	require.Equal(t, map[string]string{tenancy.SettingTenantID: "a"}, database.GetTxSettings(tenantCtx))
+	_, found = tenancy.GetTenantID(ctx)
+	require.False(t, found)
+}
+
+func TestPolicySQL(t *testing.T) {
+	policy := tenancy.Policy{Table: "sales.orders", Column: "org_id", Type: "uuid"}
+	require.Contains(t, policy.UpSQL(), `ALTER TABLE "sales"."orders" FORCE ROW LEVEL SECURITY`)
+	require.Contains(
+		t,
+		policy.UpSQL(),
+		`USING ("org_id" = NULLIF(current_setting('app.tenant_id', true), '')::uuid)`,
+	)
+	require.Contains(t, policy.DownSQL(), `DROP POLICY IF EXISTS tenant_isolation ON "sales"."orders"`)
+
+	policy = tenancy.Policy{Table: "orders"}
+	require.Contains(t, policy.UpSQL(), `"tenant_id" = NULLIF(current_setting('app.tenant_id', true), '')::text`)
+}
+
+func TestMiddleware(t *testing.T) {
+	conf := test.NewTestConfig(test.NewTestRootConfig(t))
+	conf.HttpServer.BasePath = "/api/"
+	m := tenancy.NewMiddleware(conf, test.NewLoggerFactory(t, conf.RootConfig))
+
+	serve := func(path string, principal middleware.Principal, header string) (string, error) {
+		var tenantID string
+		var err error
+		engine := gin.New()
+		engine.Use(func(ctx *gin.Context) {
+			if principal != nil {
+				middleware.SetPrincipal(ctx, principal)
+			}
+			ctx.Next()
+			if len(ctx.Errors) > 0 {
+				err = ctx.Errors.Last()
+			}
+		})
+		engine.Use(m.Run)
+		engine.GET(path, func(ctx *gin.Context) {
+			tenantID, _ = tenancy.GetTenantID(ctx)
+		})
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(conf.Tenancy.Header, header)
+		}
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+		return tenantID, err
+	}
+
+	tenantID, err := serve("/api/orders", tenantPrincipal{"a"}, "")
+	require.NoError(t, err)
+	require.Equal(t, "a", tenantID)
+
+	tenantID, err = serve("/api/orders", tenantPrincipal{"a"}, "a")
+	require.NoError(t, err)
+	require.Equal(t, "a", tenantID)
+
+	// The header is not trusted by default
+	_, err = serve("/api/orders", nil, "b")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+
+	_, err = serve("/api/orders", tenantPrincipal{}, "b")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+
+	_, err = serve("/api/orders", tenantPrincipal{"a"}, "b")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+
+	_, err = serve("/api/orders", tenantPrincipal{}, "")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+
+	tenantID, err = serve("/health", nil, "")
+	require.NoError(t, err)
+	require.Empty(t, tenantID)
+
+	conf.Tenancy.AllowHeaderTenant = true
+	m = tenancy.NewMiddleware(conf, test.NewLoggerFactory(t, conf.RootConfig))
+
+	tenantID, err = serve("/api/orders", tenantPrincipal{}, "b")
+	require.NoError(t, err)
+	require.Equal(t, "b", tenantID)
+
+	_, err = serve("/api/orders", tenantPrincipal{"a"}, "b")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+
+	_, err = serve("/api/orders", nil, "")
+	require.True(t, errors.IsCode(err, errors.ErrCodeNotAllowed))
+}
+
+func TestTenantIsolation(t *testing.T) {
+	var ctx context.Context
+	test.FxIntegration(t).WithDB().Populate(&ctx)
+	db := database.InTx(ctx)
+	require.NoError(t, db.Exec("CREATE TABLE orders (id serial PRIMARY KEY, tenant_id text NOT NULL)").Error)
+	require.NoError(t, db.Exec("INSERT INTO orders (tenant_id) VALUES ('a'), ('a'), ('b')").Error)
+	require.NoError(t, db.Exec(tenancy.Policy{Table: "orders"}.UpSQL()).Error)
+
+	test.RequireTenantIsolation(t, ctx, "orders", "tenant_id", "a")
+	test.RequireTenantIsolation(t, ctx, "orders", "tenant_id", "b")
+
+	// The statements outside of a transaction run in one with the tenant
+	tenantCtx := tenancy.SetTenantID(ctx, "b")
+	var settings []string
+	query := database.InTx(tenantCtx).Table("orders").Limit(1)
+	require.NoError(t, query.Select("current_setting(?, true)", tenancy.SettingTenantID).Find(&settings).Error)
+	require.Equal(t, []string{"b"}, settings)
+	var count int
+	err := database.InTx(tenantCtx).Raw("SELECT count(*) FROM orders").Scan(&count).Error
+	require.True(t, errors.IsCode(err, errors.ErrCodeBadState))
+
+	tx, txCtx := database.WithTx(tenantCtx)
+	defer tx.Rollback()
+	var tenantID string
+	query = database.InTx(txCtx).Raw("SELECT current_setting(?)", tenancy.SettingTenantID)
+	require.NoError(t, query.Scan(&tenantID).Error)
+	require.Equal(t, "b", tenantID)
+}
+
+func TestMiddlewareDB(t *testing.T) {
+	var ctx context.Context
+	var conf config.Config
+	var db database.DB
+	var lf *log.LoggerFactory
+	test.FxIntegration(t).WithDB().Populate(&ctx, &conf, &db, &lf)
+	require.NoError(t, database.InTx(ctx).Exec("CREATE TABLE orders (id serial PRIMARY KEY, tenant_id text)").Error)
+	conf.HttpServer.BasePath = "/api/"
+	m := tenancy.NewMiddleware(conf, lf)
+
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		db.SetCtx(ctx)
+		middleware.SetPrincipal(ctx, tenantPrincipal{"b"})
+	})
+	engine.Use(m.Run)
+	var tenantIDs []string
+	var scanErr, txErr error
+	var tenantID string
+	engine.POST("/api/orders", func(ctx *gin.Context) {
+		// The request has no transaction, every statement runs in its own with the tenant
+		require.Nil(t, database.GetDBTxFromCtx(ctx))
+		require.NoError(t, database.InTx(ctx).Exec("INSERT INTO orders (tenant_id) VALUES ('b')").Error)
+		query := database.InTx(ctx).Table("orders").Select("current_setting(?)", tenancy.SettingTenantID)
+		require.NoError(t, query.Find(&tenantIDs).Error)
+		scanErr = database.InTx(ctx).Raw("SELECT current_setting(?)", tenancy.SettingTenantID).Scan(&tenantID).Error
+		txErr = database.RunInTx(ctx, nil, func(ctx context.Context) error {
+			return database.InTx(ctx).Raw("SELECT current_setting(?)", tenancy.SettingTenantID).Scan(&tenantID).Error
+		})
+	})
+
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/orders", nil))
+	require.Equal(t, []string{"b"}, tenantIDs)
+	// Scan with the tenant needs a transaction
+	require.True(t, errors.IsCode(scanErr, errors.ErrCodeBadState))
+	require.NoError(t, txErr)
+	require.Equal(t, "b", tenantID)
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"strings"
 	"testing"
 
 	"go.uber.org/fx"
@@ -43,6 +44,24 @@ func NewTestRootConfig(tb testing.TB) config.RootConfig {
 	return rootConf
 }
 
+// testNameMarkers start the test names, and the suffix of the shared test databases, that NewTestRootConfig and
+// NewSharedTestDatabase append to the name of the app.
+var testNameMarkers = []string{"-Test", "-Benchmark", "-Fuzz", "-Example", sharedTestDBNameInfix}
+
+// testAppName returns the name of the app of the config, without the name of the test that NewTestRootConfig appends.
+func testAppName(conf config.Config) string {
+	appName := conf.Name
+	for _, marker := range testNameMarkers {
+		if idx := strings.Index(appName, marker); idx >= 0 {
+			appName = appName[:idx]
+		}
+	}
+	if appName == "" {
+		appName = "test-service"
+	}
+	return appName
+}
+
 var ModuleTestConfig = fx.Options(
 	fx.Provide(NewTestConfig),
 	fx.Provide(NewTestRootConfig),
@@ -9,29 +9,50 @@ import (
 
 	"github.com/southernlabs-io/go-fw/config"
 	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/database/migrate"
 	"github.com/southernlabs-io/go-fw/errors"
 	"github.com/southernlabs-io/go-fw/log"
 )
 
-func NewTestDatabase(conf config.Config, lf *log.LoggerFactory) database.DB {
+// NewTestDatabase creates an empty database for the test. With migrations, the database is a clone of a template
+// database with the migrations applied, which is shared by all the tests until the migrations change.
+func NewTestDatabase(conf config.Config, lf *log.LoggerFactory, migrations ...migrate.Migrations) database.DB {
 	if conf.Env.Type != config.EnvTypeTest {
 		panic(errors.Newf(errors.ErrCodeBadState, "not in a test: %+v", conf.Env))
 	}
 
 	dbName := CreateTestDBName(conf)
 	postgresDB := database.MustOpenGORM(conf, "postgres", lf)
+	defer func() {
+		if sqlDB, err := postgresDB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}()
 	lf.GetLogger().Infof("Resetting DB: %s", dbName)
 	if err := postgresDB.Exec(fmt.Sprintf(`DROP DATABASE IF EXISTS "%s" WITH (FORCE)`, dbName)).Error; err != nil {
 		panic(errors.NewUnknownf("failed to drop db: %s, error: %w", dbName, err))
 	}
-	if err := postgresDB.Exec(fmt.Sprintf(`CREATE DATABASE "%s"`, dbName)).Error; err != nil {
+	if len(migrations) > 0 {
+		createTestDBFromTemplate(conf, lf, postgresDB, dbName, migrations)
+	} else if err := postgresDB.Exec(fmt.Sprintf(`CREATE DATABASE "%s"`, dbName)).Error; err != nil {
 		panic(errors.NewUnknownf("failed to create db: %s, error: %w", dbName, err))
 	}
-	db := database.MustOpenGORM(conf, dbName, lf)
-	return database.DB{
-		DB:     db,
-		DbName: dbName,
+	return database.OpenDB(conf, dbName, lf)
+}
+
+// NewTestDatabaseFx creates the database of the test with NewTestDatabase, applying the migrations supplied with
+// migrate.Provide, if any.
+func NewTestDatabaseFx(deps struct {
+	fx.In
+
+	Conf       config.Config
+	LF         *log.LoggerFactory
+	Migrations migrate.Migrations `optional:"true"`
+}) database.DB {
+	if deps.Migrations.FS == nil {
+		return NewTestDatabase(deps.Conf, deps.LF)
 	}
+	return NewTestDatabase(deps.Conf, deps.LF, deps.Migrations)
 }
 
 var dbNameReplacer = strings.NewReplacer(
@@ -85,7 +106,7 @@ func OnTestDBStop(conf config.Config, db database.DB, lf *log.LoggerFactory) err
 
 var TestModuleDB = fx.Provide(
 	fx.Annotate(
-		NewTestDatabase,
+		NewTestDatabaseFx,
 		fx.OnStop(OnTestDBStop),
 	),
 )
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/database/migrate"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+// DBMode is how FxApp.WithDB isolates the database of a test.
+type DBMode int
+
+const (
+	// DBModeReset creates a database for the test, and drops it when the app stops.
+	DBModeReset DBMode = iota
+	// DBModeRollback runs the test in a transaction of a database shared by the tests of the package, which is rolled
+	// back when the app stops. See TestModuleDBRollback.
+	DBModeRollback
+)
+
+// sharedTestDBNameInfix separates the name of the app from the hash in the name of the shared test databases.
+const sharedTestDBNameInfix = "-shared-"
+
+// sharedTestDBs are the databases shared by the tests of the package in DBModeRollback, by name.
+var sharedTestDBs = struct {
+	sync.Mutex
+	dbs map[string]database.DB
+}{dbs: make(map[string]database.DB)}
+
+/*
+NewSharedTestDatabase returns the database shared by the tests of the package that use the same migrations. The first
+test that uses it creates it with NewTestDatabase, and it is never dropped, the next run of the tests resets it.
+
+The queries of the returned DB are logged to the test, but the ones of the migrations aren't, as the database outlives
+the test that created it.
+*/
+func NewSharedTestDatabase(conf config.Config, lf *log.LoggerFactory, migrations ...migrate.Migrations) database.DB {
+	hash, err := hashMigrations(migrations)
+	if err != nil {
+		panic(err)
+	}
+	// The tests of every package run in their own process, in the dir of the package
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(errors.NewUnknownf("failed to get the working dir, error: %w", err))
+	}
+	sum := sha256.Sum256([]byte(wd + "\x00" + hash))
+	sharedConf := conf
+	sharedConf.Name = fmt.Sprintf("%s%s%x", testAppName(conf), sharedTestDBNameInfix, sum[:8])
+
+	sharedTestDBs.Lock()
+	defer sharedTestDBs.Unlock()
+	db, found := sharedTestDBs.dbs[sharedConf.Name]
+	if !found {
+		db = NewTestDatabase(sharedConf, log.NewLoggerFactory(conf.RootConfig), migrations...)
+		sharedTestDBs.dbs[sharedConf.Name] = db
+	}
+	db.DB = db.Session(&gorm.Session{Logger: database.NewGormLogger(lf.GetLoggerForType(gorm.DB{}))})
+	return db
+}
+
+// NewSharedTestDatabaseFx returns the shared database of the test with NewSharedTestDatabase, applying the migrations
+// supplied with migrate.Provide, if any.
+func NewSharedTestDatabaseFx(deps struct {
+	fx.In
+
+	Conf       config.Config
+	LF         *log.LoggerFactory
+	Migrations migrate.Migrations `optional:"true"`
+}) database.DB {
+	if deps.Migrations.FS == nil {
+		return NewSharedTestDatabase(deps.Conf, deps.LF)
+	}
+	return NewSharedTestDatabase(deps.Conf, deps.LF, deps.Migrations)
+}
+
+// NewRollbackTestContext begins the transaction of the test in the context, and rolls it back when the app stops.
+// database.WithTx creates savepoints in it, so the code under test works as usual.
+func NewRollbackTestContext(ctx context.Context, lifecycle fx.Lifecycle) context.Context {
+	tx, ctx := database.WithTx(ctx)
+	lifecycle.Append(fx.StopHook(func() error {
+		if tx.IsClosed() {
+			return errors.Newf(errors.ErrCodeBadState, "the transaction of the test was closed by the test")
+		}
+		return tx.Rollback().Error
+	}))
+	return ctx
+}
+
+/*
+TestModuleDBRollback provides the database shared by the tests of the package, see NewSharedTestDatabase, and runs the
+test in a transaction that is rolled back when the app stops, see NewRollbackTestContext. The tests don't see the
+changes of each other, so they can run with t.Parallel().
+
+Only the code that gets the database from the context, with database.InTx or database.WithTx, runs in the transaction.
+The queries made directly with the database.DB are not rolled back.
+*/
+var TestModuleDBRollback = fx.Options(
+	fx.Provide(NewSharedTestDatabaseFx),
+	fx.Decorate(NewRollbackTestContext),
+)
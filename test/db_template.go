@@ -0,0 +1,202 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+	"gorm.io/gorm"
+
+	"github.com/southernlabs-io/go-fw/config"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/database/migrate"
+	"github.com/southernlabs-io/go-fw/errors"
+	"github.com/southernlabs-io/go-fw/log"
+)
+
+const (
+	templateDBPrefix = "tpl_"
+	// templateDBAppMaxLen leaves room in the 63 characters of a db name for the prefix and the hash
+	templateDBAppMaxLen = 40
+	templateDBHashLen   = 16
+)
+
+var templateDBAppReplacer = regexp.MustCompile("[^a-z0-9_]+")
+
+/*
+createTestDBFromTemplate creates the test database dbName as a clone of the template database of the migrations. The
+template is created and migrated the first time, and then reused by every test of the app, in this and later runs, until
+the migrations change. Then the stale templates of the app are dropped.
+
+An advisory lock serializes the tests of the app, in this and other processes, while they build or clone the template,
+as Postgres can't clone a database that has other connections.
+*/
+func createTestDBFromTemplate(
+	conf config.Config,
+	lf *log.LoggerFactory,
+	postgresDB *gorm.DB,
+	dbName string,
+	migrations []migrate.Migrations,
+) {
+	hash, err := hashMigrations(migrations)
+	if err != nil {
+		panic(err)
+	}
+	appPrefix := createTemplateDBAppPrefix(conf)
+	templateName := appPrefix + hash[:templateDBHashLen]
+
+	ctx := context.Background()
+	sqlDB, err := postgresDB.DB()
+	if err != nil {
+		panic(errors.NewUnknownf("failed to get the sql.DB, error: %w", err))
+	}
+	// The advisory lock belongs to the session, so every statement must run in the same connection
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		panic(errors.NewUnknownf("failed to get a connection, error: %w", err))
+	}
+	defer func() { _ = conn.Close() }()
+	exec := func(query string, args ...any) {
+		if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+			panic(errors.NewUnknownf("failed to run: %s, error: %w", query, err))
+		}
+	}
+
+	exec("SELECT pg_advisory_lock(hashtext($1))", appPrefix)
+	defer func() {
+		_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", appPrefix)
+	}()
+
+	var isTemplate bool
+	err = conn.QueryRowContext(ctx, "SELECT datistemplate FROM pg_database WHERE datname = $1", templateName).
+		Scan(&isTemplate)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		panic(errors.NewUnknownf("failed to look up the template db: %s, error: %w", templateName, err))
+	}
+	// The template doesn't exist yet, or a failed run left it half built and not marked as a template
+	if !isTemplate {
+		dropTemplateDBs(ctx, conn, lf, appPrefix)
+		lf.GetLogger().Infof("Creating template DB: %s", templateName)
+		exec(fmt.Sprintf(`CREATE DATABASE "%s"`, templateName))
+		migrateTemplateDB(conf, lf, templateName, migrations)
+		exec(fmt.Sprintf(`ALTER DATABASE "%s" IS_TEMPLATE true`, templateName))
+	}
+	exec(fmt.Sprintf(`CREATE DATABASE "%s" TEMPLATE "%s"`, dbName, templateName))
+}
+
+// createTemplateDBAppPrefix returns the prefix of the template databases of the app, which doesn't include the test
+// name, so all the tests share them.
+func createTemplateDBAppPrefix(conf config.Config) string {
+	appName := templateDBAppReplacer.ReplaceAllString(strings.ToLower(testAppName(conf)), "_")
+	if len(appName) > templateDBAppMaxLen {
+		appName = appName[:templateDBAppMaxLen]
+	}
+	return templateDBPrefix + appName + "_"
+}
+
+// hashMigrations returns the hex sha256 of the path and the content of every file of the migrations, and of the
+// version, the path and the content of the file of every Go migration.
+func hashMigrations(migrations []migrate.Migrations) (string, error) {
+	hash := sha256.New()
+	for _, m := range migrations {
+		dir := m.Dir
+		if dir == "" {
+			dir = "."
+		}
+		err := fs.WalkDir(m.FS, dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := fs.ReadFile(m.FS, path)
+			if err != nil {
+				return err
+			}
+			_, _ = hash.Write([]byte(path + "\x00"))
+			_, _ = hash.Write(content)
+			_, _ = hash.Write([]byte{0})
+			return nil
+		})
+		if err != nil {
+			return "", errors.NewUnknownf("failed to hash the migrations in: %s, error: %w", dir, err)
+		}
+		// The Go migrations registered in goose aren't in the FS, hash their version and the file that registers them
+		sources, err := migrate.Sources(m)
+		if err != nil {
+			return "", err
+		}
+		for _, source := range sources {
+			if source.Type != goose.TypeGo {
+				continue
+			}
+			_, _ = fmt.Fprintf(hash, "go:%d:%s\x00", source.Version, source.Path)
+			// The file is missing when the tests run from a binary built somewhere else
+			if content, err := os.ReadFile(source.Path); err == nil {
+				_, _ = hash.Write(content)
+			}
+			_, _ = hash.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dropTemplateDBs drops the template databases of the app, which only differ in the hash.
+func dropTemplateDBs(ctx context.Context, conn *sql.Conn, lf *log.LoggerFactory, appPrefix string) {
+	pattern := fmt.Sprintf("^%s[0-9a-f]{%d}$", appPrefix, templateDBHashLen)
+	rows, err := conn.QueryContext(ctx, "SELECT datname FROM pg_database WHERE datname ~ $1", pattern)
+	if err != nil {
+		panic(errors.NewUnknownf("failed to list the template dbs, error: %w", err))
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			panic(errors.NewUnknownf("failed to list the template dbs, error: %w", err))
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		panic(errors.NewUnknownf("failed to list the template dbs, error: %w", err))
+	}
+	_ = rows.Close()
+
+	for _, name := range names {
+		lf.GetLogger().Infof("Dropping template DB: %s", name)
+		// Postgres refuses to drop a template
+		for _, query := range []string{
+			fmt.Sprintf(`ALTER DATABASE "%s" IS_TEMPLATE false`, name),
+			fmt.Sprintf(`DROP DATABASE IF EXISTS "%s" WITH (FORCE)`, name),
+		} {
+			if _, err = conn.ExecContext(ctx, query); err != nil {
+				panic(errors.NewUnknownf("failed to drop template db: %s, error: %w", name, err))
+			}
+		}
+	}
+}
+
+// migrateTemplateDB applies the migrations to the template database, and closes it, as Postgres can't clone a database
+// that has connections.
+func migrateTemplateDB(conf config.Config, lf *log.LoggerFactory, templateName string, migrations []migrate.Migrations) {
+	conf.Database.Replicas = nil
+	db := database.OpenDB(conf, templateName, lf)
+	defer func() {
+		if err := database.OnDBStop(db); err != nil {
+			panic(errors.NewUnknownf("failed to close template db: %s, error: %w", templateName, err))
+		}
+	}()
+	for _, m := range migrations {
+		migrator, err := migrate.NewMigrator(db, m, lf)
+		if err != nil {
+			panic(err)
+		}
+		if _, err = migrator.Up(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+}
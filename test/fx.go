@@ -77,7 +77,12 @@ func FxIntegrationWithDB(t *testing.T, opts ...fx.Option) *FxApp {
 	)
 }
 
-func (a *FxApp) WithDB() *FxApp {
+// WithDB adds the test database, isolated with the given mode, DBModeReset by default.
+func (a *FxApp) WithDB(mode ...DBMode) *FxApp {
+	if len(mode) > 0 && mode[0] == DBModeRollback {
+		a.opts = fx.Options(a.opts, TestModuleDBRollback)
+		return a
+	}
 	a.opts = fx.Options(a.opts, TestModuleDB)
 	return a
 }
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/southernlabs-io/go-fw/context"
+	"github.com/southernlabs-io/go-fw/database"
+	"github.com/southernlabs-io/go-fw/tenancy"
+)
+
+// TenancyTestRole is the role without RLS bypass that RequireTenantIsolation queries the tables with.
+const TenancyTestRole = "fw_tenancy_test"
+
+/*
+RequireTenantIsolation requires that the tenancy.Policy of the table isolates the rows of the tenant from the ones of
+the other tenants, which must be in the table. The rows are counted as the test user, which must be a superuser or a
+BYPASSRLS role, as the policy forces RLS on the owner too. Then it checks the policy as the TenancyTestRole, in a
+transaction that is rolled back:
+  - With the tenant, only its rows are visible, and the rows of the other tenants can't be updated.
+  - Without a tenant, no row is visible.
+*/
+func RequireTenantIsolation(t *testing.T, ctx context.Context, table string, column string, tenantID string) {
+	t.Helper()
+	tableParts := strings.Split(table, ".")
+	schemaName := "public"
+	if len(tableParts) > 1 {
+		schemaName = tableParts[0]
+	}
+	tableID := pgx.Identifier(tableParts).Sanitize()
+	columnID := pgx.Identifier{column}.Sanitize()
+	ownCondition := fmt.Sprintf("%s::text = ?", columnID)
+	otherCondition := fmt.Sprintf("%s::text <> ?", columnID)
+
+	db := database.InTx(ctx)
+	var bypassRLS []bool
+	query := db.Table("pg_roles").Where("rolname = current_user")
+	require.NoError(t, query.Pluck("rolsuper OR rolbypassrls", &bypassRLS).Error)
+	require.Equal(
+		t,
+		[]bool{true},
+		bypassRLS,
+		"the test user must be a superuser or a BYPASSRLS role to count the rows of every tenant in table: %s",
+		table,
+	)
+	var ownRows, otherRows int64
+	require.NoError(t, db.Table(table).Where(ownCondition, tenantID).Count(&ownRows).Error)
+	require.NoError(t, db.Table(table).Where(otherCondition, tenantID).Count(&otherRows).Error)
+	require.Positive(t, ownRows, "no rows of tenant: %s in table: %s", tenantID, table)
+	require.Positive(t, otherRows, "no rows of other tenants in table: %s", table)
+
+	// Concurrent tests can create the role at the same time
+	require.NoError(t, db.Exec(fmt.Sprintf(`
+		DO $$ BEGIN
+			CREATE ROLE %[1]s NOLOGIN NOBYPASSRLS;
+		EXCEPTION WHEN duplicate_object OR unique_violation THEN NULL;
+		END $$;
+		GRANT USAGE ON SCHEMA %[2]s TO %[1]s;
+		GRANT SELECT, UPDATE ON %[3]s TO %[1]s`,
+		TenancyTestRole,
+		pgx.Identifier{schemaName}.Sanitize(),
+		tableID,
+	)).Error)
+
+	asRole := func(tenantID string, check func(tx *database.DBTx)) {
+		tx, _ := database.WithTx(tenancy.SetTenantID(ctx, tenantID))
+		defer tx.Rollback()
+		require.NoError(t, tx.Error)
+		require.NoError(t, tx.Exec("SET LOCAL ROLE "+TenancyTestRole).Error)
+		check(tx)
+	}
+
+	asRole(tenantID, func(tx *database.DBTx) {
+		var visibleRows, visibleOtherRows int64
+		require.NoError(t, tx.Table(table).Count(&visibleRows).Error)
+		require.Equal(t, ownRows, visibleRows, "tenant: %s doesn't see only its rows in table: %s", tenantID, table)
+		require.NoError(t, tx.Table(table).Where(otherCondition, tenantID).Count(&visibleOtherRows).Error)
+		require.Zero(t, visibleOtherRows, "tenant: %s sees rows of other tenants in table: %s", tenantID, table)
+
+		result := tx.Exec(
+			fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s", tableID, columnID, columnID, otherCondition),
+			tenantID,
+		)
+		require.NoError(t, result.Error)
+		require.Zero(t, result.RowsAffected, "tenant: %s updated rows of other tenants in table: %s", tenantID, table)
+	})
+
+	asRole("", func(tx *database.DBTx) {
+		var visibleRows int64
+		require.NoError(t, tx.Table(table).Count(&visibleRows).Error)
+		require.Zero(t, visibleRows, "rows visible without a tenant in table: %s", table)
+	})
+}